@@ -0,0 +1,112 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ *
+ * Accept :: RFC 7231, section 5.3.2
+ */
+
+package sdtp
+
+import (
+    "strings"
+    "strconv"
+)
+
+// A media range of an Accept header.
+type acceptRange struct {
+    typ     string
+    subtype string
+    q       float64
+}
+
+type acceptRangeList []acceptRange
+
+// Parses an Accept header. Malformed ranges are skipped.
+func parseAccept(accept string) acceptRangeList {
+    ranges := make(acceptRangeList, 0, 4)
+
+    for _, part := range strings.Split(accept, ",") {
+        params := strings.Split(part, ";")
+
+        media_type := strings.ToLower(strings.TrimSpace(params[0]))
+        slash := strings.IndexByte(media_type, '/')
+        if slash <= 0 || slash == len(media_type) - 1 {
+            continue
+        }
+
+        ar := acceptRange{
+            typ:     media_type[:slash],
+            subtype: media_type[slash + 1:],
+            q:       1,
+        }
+
+        if ar.typ == "*" && ar.subtype != "*" {
+            continue
+        }
+
+        for _, param := range params[1:] {
+            kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+            if len(kv) != 2 || strings.ToLower(strings.TrimSpace(kv[0])) != "q" {
+                continue
+            }
+
+            q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+            if err != nil || q < 0 || q > 1 {
+                q = 0
+            }
+            ar.q = q
+        }
+
+        ranges = append(ranges, ar)
+    }
+
+    return ranges
+}
+
+// Returns the quality given to media_type by the most specific matching
+// range, or -1 when no range matches.
+func (ranges acceptRangeList) quality(media_type string) float64 {
+    slash := strings.IndexByte(media_type, '/')
+    typ, subtype := media_type[:slash], media_type[slash + 1:]
+
+    q, specificity := -1.0, -1
+
+    for _, ar := range ranges {
+        s := -1
+
+        switch {
+            case ar.typ == typ && ar.subtype == subtype:
+                s = 2
+            case ar.typ == typ && ar.subtype == "*":
+                s = 1
+            case ar.typ == "*" && ar.subtype == "*":
+                s = 0
+        }
+
+        if s > specificity {
+            q, specificity = ar.q, s
+        }
+    }
+
+    return q
+}
+
+// Returns the offer with the highest quality in the Accept header, offers
+// being listed in order of preference to break ties. An empty header accepts
+// the first offer. Returns false when no offer is acceptable.
+func negotiate(accept string, offers []string) (string, bool) {
+    if strings.TrimSpace(accept) == "" {
+        return offers[0], true
+    }
+
+    ranges := parseAccept(accept)
+    best, best_q := "", 0.0
+
+    for _, offer := range offers {
+        if q := ranges.quality(offer); q > best_q {
+            best, best_q = offer, q
+        }
+    }
+
+    return best, best != ""
+}
@@ -0,0 +1,123 @@
+package sdtp
+
+import (
+    "strings"
+    "testing"
+    "context"
+    "net/http"
+    "net/http/httptest"
+)
+
+func TestNegotiate(t *testing.T) {
+    offers := []string{"application/msgpack", "application/json", "application/cbor"}
+
+    tests := []struct {
+        accept string
+        want   string
+        ok     bool
+    }{
+        {"", "application/msgpack", true},
+        {"  ", "application/msgpack", true},
+        {"application/json", "application/json", true},
+        {"Application/JSON", "application/json", true},
+        {"application/json; charset=utf-8", "application/json", true},
+        {"text/html", "", false},
+        {"text/html, */*;q=0.1", "application/msgpack", true},
+        // Ties go to the order of preference
+        {"application/json, application/cbor", "application/json", true},
+        {"application/*", "application/msgpack", true},
+        // q-values
+        {"application/json;q=0.5, application/cbor", "application/cbor", true},
+        {"application/json;q=0.9, application/*;q=0.1", "application/json", true},
+        // The most specific range wins, whatever its order
+        {"application/json;q=0, application/*", "application/msgpack", true},
+        {"application/*, application/msgpack;q=0", "application/json", true},
+        {"*/*, application/*;q=0", "", false},
+        {"*/*;q=0", "", false},
+        // Malformed ranges and q-values
+        {"*/json", "", false},
+        {"application, json", "", false},
+        {"application/json;q=2", "", false},
+        {"application/json;q=x, application/cbor;q=0.1", "application/cbor", true},
+        {"application/json;level=1;q=0.8, application/cbor;q=0.7", "application/json", true},
+    }
+
+    for _, test := range tests {
+        if got, ok := negotiate(test.accept, offers); got != test.want || ok != test.ok {
+            t.Errorf("negotiate(%q) = %q, %v, want %q, %v", test.accept, got, ok, test.want, test.ok)
+        }
+    }
+}
+
+// Returns a mux whose "create" method counts its calls.
+func newCountingMux(calls *int) *Mux {
+    m := NewMux()
+
+    m.HandleFunc("create", func(req *Request, r *http.Request) (interface{}, error) {
+        *calls++
+        return "created", nil
+    })
+
+    return m
+}
+
+func TestNotAcceptableSkipsHandlers(t *testing.T) {
+    calls := 0
+
+    handlers := map[string]http.Handler{
+        "mux": newCountingMux(&calls),
+        "handler": Handler(func(ctx context.Context, req *Request) (interface{}, error) {
+            calls++
+            return "created", nil
+        }),
+    }
+
+    bodies := []string{
+        `{"id": 1, "method": "create"}`,
+        `[{"id": 1, "method": "create"}, {"method": "create"}]`,
+    }
+
+    for name, h := range handlers {
+        for _, body := range bodies {
+            if name == "handler" && strings.HasPrefix(body, "[") {
+                continue
+            }
+
+            r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+            r.Header.Set("Content-Type", "application/json")
+            r.Header.Set("Accept", "text/html")
+
+            w := httptest.NewRecorder()
+            h.ServeHTTP(w, r)
+
+            var response map[string]interface{}
+            if err := (MsgpackCodec{}).Unmarshal(w.Body.Bytes(), &response); err != nil {
+                t.Fatalf("%s %s: %v", name, body, err)
+            }
+
+            if err_d, _ := response["error"].(map[string]interface{}); toCode(err_d["code"]) != NotAcceptable {
+                t.Errorf("%s %s: response = %v, want NotAcceptable", name, body, response)
+            }
+        }
+    }
+
+    if calls != 0 {
+        t.Errorf("handlers ran %d times, want none", calls)
+    }
+}
+
+func TestNotAcceptableNotification(t *testing.T) {
+    calls := 0
+
+    r := httptest.NewRequest("POST", "/", strings.NewReader(`{"method": "create"}`))
+    r.Header.Set("Content-Type", "application/json")
+    r.Header.Set("Accept", "text/html")
+
+    // Notifications have no body to negotiate
+    w := httptest.NewRecorder()
+    newCountingMux(&calls).ServeHTTP(w, r)
+
+    if w.Code != http.StatusNoContent || calls != 1 {
+        t.Errorf("status = %d, calls = %d, want 204 and the handler run", w.Code, calls)
+    }
+}
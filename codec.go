@@ -0,0 +1,337 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ *
+ * Codecs :: "application/msgpack" (default), "application/json", "application/cbor"
+ */
+
+package sdtp
+
+import (
+    "io"
+    "mime"
+    "sync"
+    "bytes"
+    "errors"
+    "encoding/json"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+// Codec encodes and decodes the messages of a media type.
+type Codec interface {
+    Marshal(v interface{}) ([]byte, error)
+    Unmarshal(data []byte, v interface{}) error
+
+    // ContentType returns the Content-Type header of encoded messages, e.g.
+    // "application/json; charset=utf-8".
+    ContentType() string
+}
+
+// StreamCodec is implemented by codecs able to encode a result item by item,
+// without holding the whole result in memory.
+type StreamCodec interface {
+    Codec
+
+    NewStreamEncoder(w io.Writer) StreamEncoder
+}
+
+// StreamEncoder writes {"id": <ID>, "result": [<ITEM>, ...]} one item at a
+// time, followed by "error": <ERROR> when the producer failed midway.
+type StreamEncoder interface {
+    Begin(id interface{}) error
+
+    // Item writes an item of the result. It returns an *EncodeError, having
+    // written nothing, when v cannot be encoded, so that the result can
+    // still be ended.
+    Item(v interface{}) error
+
+    // End closes the result, err_d is the trailing error object, or nil.
+    End(err_d interface{}) error
+}
+
+// EncodeError is returned by StreamEncoder.Item for an item that cannot be
+// encoded, as a func or a chan.
+type EncodeError struct {
+    Err error
+}
+
+func (e *EncodeError) Error() string {
+    return "sdtp: cannot encode item: " + e.Err.Error()
+}
+
+func (e *EncodeError) Unwrap() error {
+    return e.Err
+}
+
+// SizedStreamCodec is implemented by codecs able to encode a result item by
+// item when the number of items is known beforehand, as msgpack.
+type SizedStreamCodec interface {
+    Codec
+
+    // NewSizedStreamEncoder returns an encoder for a result of count items.
+    // Begin, Item and End are called as for a StreamEncoder, with at most
+    // count calls to Item.
+    NewSizedStreamEncoder(w io.Writer, count int) StreamEncoder
+}
+
+// Registered codecs, in order of preference. The first one is the default.
+var codecs struct {
+    sync.RWMutex
+    list []Codec
+}
+
+func init() {
+    RegisterCodec(MsgpackCodec{})
+    RegisterCodec(JsonCodec{})
+}
+
+// RegisterCodec makes a codec available for requests and responses. A codec
+// registered for an existing media type replaces it, otherwise it is added
+// with the lowest preference.
+func RegisterCodec(c Codec) {
+    media_type := mediaTypeOf(c.ContentType())
+    if media_type == "" {
+        panic("sdtp: invalid codec content type " + c.ContentType())
+    }
+
+    codecs.Lock()
+    defer codecs.Unlock()
+
+    for i, registered := range codecs.list {
+        if mediaTypeOf(registered.ContentType()) == media_type {
+            codecs.list[i] = c
+            return
+        }
+    }
+
+    codecs.list = append(codecs.list, c)
+}
+
+// CodecFor returns the codec registered for the media type of content_type,
+// or nil.
+func CodecFor(content_type string) Codec {
+    media_type := mediaTypeOf(content_type)
+
+    codecs.RLock()
+    defer codecs.RUnlock()
+
+    for _, c := range codecs.list {
+        if mediaTypeOf(c.ContentType()) == media_type {
+            return c
+        }
+    }
+
+    return nil
+}
+
+// Returns the default codec.
+func defaultCodec() Codec {
+    codecs.RLock()
+    defer codecs.RUnlock()
+
+    return codecs.list[0]
+}
+
+// Returns the media types of the registered codecs, in order of preference.
+func codecMediaTypes() []string {
+    codecs.RLock()
+    defer codecs.RUnlock()
+
+    media_types := make([]string, len(codecs.list))
+    for i, c := range codecs.list {
+        media_types[i] = mediaTypeOf(c.ContentType())
+    }
+
+    return media_types
+}
+
+// Returns the media type of a Content-Type header, without parameters.
+func mediaTypeOf(content_type string) string {
+    media_type, _, err := mime.ParseMediaType(content_type)
+    if err != nil {
+        return ""
+    }
+
+    return media_type
+}
+
+// Returns true when the codec produces text, i.e. declares a charset.
+func isTextCodec(c Codec) bool {
+    _, params, err := mime.ParseMediaType(c.ContentType())
+
+    return err == nil && params["charset"] != ""
+}
+
+// JsonCodec encodes messages as JSON. Numbers decoded into interface{} are
+// kept as json.Number.
+type JsonCodec struct{}
+
+func (JsonCodec) Marshal(v interface{}) ([]byte, error) {
+    return json.Marshal(v)
+}
+
+func (JsonCodec) Unmarshal(data []byte, v interface{}) error {
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.UseNumber()
+
+    if err := dec.Decode(v); err != nil {
+        return err
+    }
+
+    if _, err := dec.Token(); err != io.EOF {
+        return errors.New("sdtp: trailing data after JSON value")
+    }
+
+    return nil
+}
+
+func (JsonCodec) ContentType() string {
+    return "application/json; charset=utf-8"
+}
+
+func (JsonCodec) NewStreamEncoder(w io.Writer) StreamEncoder {
+    return &jsonStreamEncoder{w: w}
+}
+
+type jsonStreamEncoder struct {
+    w     io.Writer
+    items int
+}
+
+// Writes the prefix followed by the JSON encoding of v.
+func (e *jsonStreamEncoder) write(prefix string, v interface{}) error {
+    raw, err := json.Marshal(v)
+    if err != nil {
+        return err
+    }
+
+    if _, err := io.WriteString(e.w, prefix); err != nil {
+        return err
+    }
+
+    _, err = e.w.Write(raw)
+
+    return err
+}
+
+func (e *jsonStreamEncoder) Begin(id interface{}) error {
+    if err := e.write(`{"id":`, id); err != nil {
+        return err
+    }
+
+    _, err := io.WriteString(e.w, `,"result":[`)
+
+    return err
+}
+
+func (e *jsonStreamEncoder) Item(v interface{}) error {
+    raw, err := json.Marshal(v)
+    if err != nil {
+        return &EncodeError{Err: err}
+    }
+
+    if e.items > 0 {
+        if _, err := io.WriteString(e.w, ","); err != nil {
+            return err
+        }
+    }
+
+    e.items++
+
+    _, err = e.w.Write(raw)
+
+    return err
+}
+
+func (e *jsonStreamEncoder) End(err_d interface{}) error {
+    if _, err := io.WriteString(e.w, "]"); err != nil {
+        return err
+    }
+
+    if err_d != nil {
+        if err := e.write(`,"error":`, err_d); err != nil {
+            return err
+        }
+    }
+
+    _, err := io.WriteString(e.w, "}")
+
+    return err
+}
+
+// MsgpackCodec encodes messages as msgpack. Decoding falls back to the json
+// struct tags when no msgpack tag is set. msgpack has no indefinite length
+// arrays, so it implements SizedStreamCodec but not StreamCodec.
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+    return msgpack.Marshal(v)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+    return msgpack.NewDecoder(bytes.NewReader(data)).UseJSONTag(true).Decode(v)
+}
+
+func (MsgpackCodec) ContentType() string {
+    return "application/msgpack"
+}
+
+// NewSizedStreamEncoder returns an encoder writing a map of 3 entries, the
+// "error" one being nil unless the producer failed. A result ended with less
+// than count items is padded with nil items.
+func (MsgpackCodec) NewSizedStreamEncoder(w io.Writer, count int) StreamEncoder {
+    return &msgpackStreamEncoder{w: w, enc: msgpack.NewEncoder(w), count: count}
+}
+
+type msgpackStreamEncoder struct {
+    w     io.Writer
+    enc   *msgpack.Encoder
+    count int
+    items int
+}
+
+func (e *msgpackStreamEncoder) Begin(id interface{}) error {
+    if err := e.enc.EncodeMapLen(3); err != nil {
+        return err
+    }
+
+    for _, v := range []interface{}{"id", id, "result"} {
+        if err := e.enc.Encode(v); err != nil {
+            return err
+        }
+    }
+
+    return e.enc.EncodeArrayLen(e.count)
+}
+
+func (e *msgpackStreamEncoder) Item(v interface{}) error {
+    if e.items >= e.count {
+        return errors.New("sdtp: more items than announced")
+    }
+
+    raw, err := msgpack.Marshal(v)
+    if err != nil {
+        return &EncodeError{Err: err}
+    }
+
+    e.items++
+
+    _, err = e.w.Write(raw)
+
+    return err
+}
+
+func (e *msgpackStreamEncoder) End(err_d interface{}) error {
+    for ; e.items < e.count; e.items++ {
+        if err := e.enc.EncodeNil(); err != nil {
+            return err
+        }
+    }
+
+    if err := e.enc.EncodeString("error"); err != nil {
+        return err
+    }
+
+    return e.enc.Encode(err_d)
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ *
+ * Codec :: "application/cbor", RFC 8949
+ */
+
+package sdtp
+
+import (
+    "io"
+    "reflect"
+
+    "github.com/fxamacker/cbor/v2"
+)
+
+// Deterministic encoding (RFC 8949, section 4.2.1): map keys are sorted and
+// every value uses its shortest form, so equal envelopes encode to the same
+// bytes.
+var cborEncMode = mustCborEncMode()
+
+// Streamed results use indefinite length maps and arrays, which deterministic
+// encoding forbids. Items are still encoded deterministically.
+var cborStreamEncMode = mustCborStreamEncMode()
+
+// Maps are decoded with string keys, as with the other codecs.
+var cborDecMode = mustCborDecMode()
+
+func init() {
+    RegisterCodec(CborCodec{})
+}
+
+func mustCborEncMode() cbor.EncMode {
+    mode, err := cbor.CoreDetEncOptions().EncMode()
+    if err != nil {
+        panic(err)
+    }
+
+    return mode
+}
+
+func mustCborStreamEncMode() cbor.EncMode {
+    opts := cbor.CoreDetEncOptions()
+    opts.IndefLength = cbor.IndefLengthAllowed
+
+    mode, err := opts.EncMode()
+    if err != nil {
+        panic(err)
+    }
+
+    return mode
+}
+
+func mustCborDecMode() cbor.DecMode {
+    mode, err := cbor.DecOptions{
+        DefaultMapType: reflect.TypeOf(map[string]interface{}(nil)),
+    }.DecMode()
+    if err != nil {
+        panic(err)
+    }
+
+    return mode
+}
+
+// CborCodec encodes messages as deterministic CBOR. Struct fields are named
+// by their cbor tag, falling back to the json tag.
+type CborCodec struct{}
+
+func (CborCodec) Marshal(v interface{}) ([]byte, error) {
+    return cborEncMode.Marshal(v)
+}
+
+func (CborCodec) Unmarshal(data []byte, v interface{}) error {
+    return cborDecMode.Unmarshal(data, v)
+}
+
+func (CborCodec) ContentType() string {
+    return "application/cbor"
+}
+
+func (CborCodec) NewStreamEncoder(w io.Writer) StreamEncoder {
+    return &cborStreamEncoder{enc: cborStreamEncMode.NewEncoder(w)}
+}
+
+type cborStreamEncoder struct {
+    enc *cbor.Encoder
+}
+
+func (e *cborStreamEncoder) Begin(id interface{}) error {
+    if err := e.enc.StartIndefiniteMap(); err != nil {
+        return err
+    }
+
+    for _, v := range []interface{}{"id", id, "result"} {
+        if err := e.enc.Encode(v); err != nil {
+            return err
+        }
+    }
+
+    return e.enc.StartIndefiniteArray()
+}
+
+func (e *cborStreamEncoder) Item(v interface{}) error {
+    raw, err := cborStreamEncMode.Marshal(v)
+    if err != nil {
+        return &EncodeError{Err: err}
+    }
+
+    return e.enc.Encode(cbor.RawMessage(raw))
+}
+
+func (e *cborStreamEncoder) End(err_d interface{}) error {
+    if err := e.enc.EndIndefinite(); err != nil {
+        return err
+    }
+
+    if err_d != nil {
+        if err := e.enc.Encode("error"); err != nil {
+            return err
+        }
+
+        if err := e.enc.Encode(err_d); err != nil {
+            return err
+        }
+    }
+
+    return e.enc.EndIndefinite()
+}
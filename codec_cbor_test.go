@@ -0,0 +1,133 @@
+package sdtp
+
+import (
+    "bytes"
+    "testing"
+    "encoding/hex"
+)
+
+// Returns a response envelope carrying an error with parameter errors.
+func newTestErrorEnvelope() R1 {
+    err_map := NewErrorData()
+    err_map = AddErrorData(err_map, map[string]interface{}{"code": TooLow, "location": "field:name", "message": "Too low"})
+    err_map = AddErrorData(err_map, map[string]interface{}{"message": "Required", "location": "field:email", "code": Required})
+
+    result_map := New()
+
+    AddId(result_map, "a1")
+    AddError(result_map, map[string]interface{}{"code": InvalidParams, "message": "Invalid params", "data": err_map})
+
+    return result_map
+}
+
+func TestCborRoundTrip(t *testing.T) {
+    envelopes := []interface{}{
+        R1{"id": 1, "result": map[string]interface{}{"name": "x", "tags": []interface{}{"a", "b"}, "n": -3}},
+        R1{"id": nil, "result": true},
+        newTestErrorEnvelope(),
+        []R1{{"id": 1, "result": 1.5}, newTestErrorEnvelope()},
+    }
+
+    codec := CborCodec{}
+
+    for _, envelope := range envelopes {
+        raw, err := codec.Marshal(envelope)
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        var decoded interface{}
+        if err := codec.Unmarshal(raw, &decoded); err != nil {
+            t.Fatal(err)
+        }
+
+        again, err := codec.Marshal(decoded)
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        if !bytes.Equal(raw, again) {
+            t.Errorf("%v: round trip encodes to %x, want %x", envelope, again, raw)
+        }
+    }
+}
+
+func TestCborDecodesStringKeyedMaps(t *testing.T) {
+    raw, err := CborCodec{}.Marshal(newTestErrorEnvelope())
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var decoded interface{}
+    if err := (CborCodec{}).Unmarshal(raw, &decoded); err != nil {
+        t.Fatal(err)
+    }
+
+    envelope, ok := decoded.(map[string]interface{})
+    if !ok {
+        t.Fatalf("decoded %T, want map[string]interface{}", decoded)
+    }
+
+    err_d, ok := envelope["error"].(map[string]interface{})
+    if !ok {
+        t.Fatalf("error is %T, want map[string]interface{}", envelope["error"])
+    }
+
+    data, ok := err_d["data"].([]interface{})
+    if !ok || len(data) != 2 {
+        t.Fatalf("data = %v, want 2 entries", err_d["data"])
+    }
+
+    if entry, _ := data[1].(map[string]interface{}); entry["location"] != "field:email" {
+        t.Errorf("data[1] = %v, want the entry of field:email", data[1])
+    }
+}
+
+func TestCborIsDeterministic(t *testing.T) {
+    // Same envelopes, maps built in different orders
+    a := R1{}
+    a["id"] = 7
+    a["result"] = map[string]interface{}{"b": 2, "a": 1, "c": []interface{}{map[string]interface{}{"y": 1, "x": 2}}}
+
+    b := R1{}
+    b["result"] = map[string]interface{}{"c": []interface{}{map[string]interface{}{"x": 2, "y": 1}}, "a": 1, "b": 2}
+    b["id"] = 7
+
+    raw_a, err := CborCodec{}.Marshal(a)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // Go randomizes map iteration, encoding several times covers more orders
+    for i := 0; i < 20; i++ {
+        raw_b, err := CborCodec{}.Marshal(b)
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        if !bytes.Equal(raw_a, raw_b) {
+            t.Fatalf("encodings differ: %x and %x", raw_a, raw_b)
+        }
+    }
+
+    first, _ := CborCodec{}.Marshal(newTestErrorEnvelope())
+    for i := 0; i < 20; i++ {
+        if raw, _ := (CborCodec{}).Marshal(newTestErrorEnvelope()); !bytes.Equal(first, raw) {
+            t.Fatalf("error envelope encodings differ: %x and %x", first, raw)
+        }
+    }
+}
+
+func TestCborCanonicalBytes(t *testing.T) {
+    raw, err := CborCodec{}.Marshal(R1{"result": true, "id": 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // {"id": 1, "result": true}, keys sorted and shortest integer form
+    want := "a2" + "626964" + "01" + "66726573756c74" + "f5"
+
+    if got := hex.EncodeToString(raw); got != want {
+        t.Errorf("encoded %s, want %s", got, want)
+    }
+}
@@ -0,0 +1,138 @@
+package sdtp
+
+import (
+    "reflect"
+    "testing"
+    "encoding/json"
+)
+
+func TestJsonUnmarshal(t *testing.T) {
+    tests := []struct {
+        data string
+        want interface{}
+        ok   bool
+    }{
+        {`{"a": 1}`, map[string]interface{}{"a": json.Number("1")}, true},
+        {" [1, \"b\"] \n", []interface{}{json.Number("1"), "b"}, true},
+        {`{"a": 1}}`, nil, false},
+        {`{"a": 1}]`, nil, false},
+        {`[1]]`, nil, false},
+        {`{"a": 1} {"b": 2}`, nil, false},
+        {`1 2`, nil, false},
+        {`{"a": 1} x`, nil, false},
+        {`{"a": 1`, nil, false},
+        {``, nil, false},
+    }
+
+    for _, test := range tests {
+        var v interface{}
+        err := (JsonCodec{}).Unmarshal([]byte(test.data), &v)
+
+        if (err == nil) != test.ok {
+            t.Errorf("%q: err = %v, want ok %v", test.data, err, test.ok)
+            continue
+        }
+
+        if test.ok && !reflect.DeepEqual(v, test.want) {
+            t.Errorf("%q: decoded %#v, want %#v", test.data, v, test.want)
+        }
+    }
+}
+
+// Restores the registered codecs once the test ends.
+func restoreCodecs(t *testing.T) {
+    codecs.RLock()
+    list := append([]Codec(nil), codecs.list...)
+    codecs.RUnlock()
+
+    t.Cleanup(func() {
+        codecs.Lock()
+        codecs.list = list
+        codecs.Unlock()
+    })
+}
+
+// A JSON codec answering with another Content-Type.
+type customJsonCodec struct {
+    JsonCodec
+
+    content_type string
+}
+
+func (c customJsonCodec) ContentType() string {
+    return c.content_type
+}
+
+func TestDefaultCodecs(t *testing.T) {
+    want := []string{"application/msgpack", "application/json", "application/cbor"}
+    if media_types := codecMediaTypes(); !reflect.DeepEqual(media_types, want) {
+        t.Errorf("media types = %v, want %v", media_types, want)
+    }
+
+    if _, ok := defaultCodec().(MsgpackCodec); !ok {
+        t.Errorf("default codec = %T, want MsgpackCodec", defaultCodec())
+    }
+}
+
+func TestCodecFor(t *testing.T) {
+    tests := []struct {
+        content_type string
+        want         Codec
+    }{
+        {"application/json", JsonCodec{}},
+        {"Application/JSON; charset=utf-8", JsonCodec{}},
+        {"application/msgpack", MsgpackCodec{}},
+        {"application/cbor", CborCodec{}},
+        {"text/html", nil},
+        {"", nil},
+        {"application/", nil},
+    }
+
+    for _, test := range tests {
+        if c := CodecFor(test.content_type); c != test.want {
+            t.Errorf("CodecFor(%q) = %T, want %T", test.content_type, c, test.want)
+        }
+    }
+}
+
+func TestRegisterCodec(t *testing.T) {
+    restoreCodecs(t)
+
+    // Replaced in place, keeping its preference
+    replaced := customJsonCodec{content_type: "application/json; charset=utf-8"}
+    RegisterCodec(replaced)
+
+    if c := CodecFor("application/json"); c != replaced {
+        t.Errorf("CodecFor = %T, want the replacing codec", c)
+    }
+
+    added := customJsonCodec{content_type: "application/vnd.sdtp+json"}
+    RegisterCodec(added)
+
+    want := []string{"application/msgpack", "application/json", "application/cbor", "application/vnd.sdtp+json"}
+    if media_types := codecMediaTypes(); !reflect.DeepEqual(media_types, want) {
+        t.Errorf("media types = %v, want %v", media_types, want)
+    }
+
+    if c := CodecFor("application/vnd.sdtp+json"); c != added {
+        t.Errorf("CodecFor = %T, want the added codec", c)
+    }
+
+    // Replacing the default keeps it the default
+    RegisterCodec(customJsonCodec{content_type: "application/msgpack"})
+    if c, ok := defaultCodec().(customJsonCodec); !ok || c.content_type != "application/msgpack" {
+        t.Errorf("default codec = %#v, want the replacing codec", defaultCodec())
+    }
+}
+
+func TestRegisterCodecPanics(t *testing.T) {
+    restoreCodecs(t)
+
+    defer func() {
+        if recover() == nil {
+            t.Error("RegisterCodec without content type does not panic")
+        }
+    }()
+
+    RegisterCodec(customJsonCodec{content_type: ""})
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ */
+
+package sdtp
+
+import (
+    "context"
+    "net/http"
+)
+
+// Config holds the hooks used when answering requests. A Config is attached
+// to the requests of a handler with Wrap, requests without one use
+// DefaultConfig. The zero value is ready to use.
+type Config struct {
+    // Logger is called with every response sent, nil disables logging.
+    Logger Logger
+
+    // Metrics is called with every response sent, nil disables metrics.
+    Metrics Metrics
+
+    // Timing enables the Server-Timing and X-Response-Time headers on HTTP
+    // responses.
+    Timing bool
+
+    // Translator provides the messages of the error objects, nil uses
+    // DefaultTranslator.
+    Translator Translator
+
+    // MaxBodySize limits the size in bytes of request bodies and WebSocket
+    // messages. 0 uses DefaultMaxBodySize, a negative value disables the
+    // limit.
+    MaxBodySize int64
+}
+
+// DefaultConfig is used by requests that carry no Config.
+var DefaultConfig = &Config{}
+
+// Size limit of request bodies when the Config sets none.
+const DefaultMaxBodySize = 4 << 20
+
+// Wrap returns a handler answering the requests of h with this Config.
+func (c *Config) Wrap(h http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        h.ServeHTTP(w, withTiming(WithConfig(r, c)))
+    })
+}
+
+// WithConfig returns a shallow copy of r answered with the given Config.
+func WithConfig(r *http.Request, c *Config) *http.Request {
+    return r.WithContext(context.WithValue(r.Context(), configKey, c))
+}
+
+// Returns the Translator of the Config.
+func (c *Config) translator() Translator {
+    if c.Translator == nil {
+        return DefaultTranslator
+    }
+
+    return c.Translator
+}
+
+// Returns the size limit of request bodies, 0 when there is none.
+func (c *Config) maxBodySize() int64 {
+    switch {
+        case c.MaxBodySize == 0:
+            return DefaultMaxBodySize
+        case c.MaxBodySize < 0:
+            return 0
+    }
+
+    return c.MaxBodySize
+}
+
+// Returns the Config r is answered with.
+func configOf(r *http.Request) *Config {
+    if c, ok := r.Context().Value(configKey).(*Config); ok && c != nil {
+        return c
+    }
+
+    return DefaultConfig
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ *
+ * Cursor :: base64url(<PAYLOAD>) "." base64url(HMAC-SHA256(<PAYLOAD>))
+ * Payload :: {"v": <VALUE>, "exp": <UNIX TIME>}
+ */
+
+package sdtp
+
+import (
+    "time"
+    "errors"
+    "strconv"
+    "strings"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/json"
+    "encoding/base64"
+)
+
+// ErrInvalidCursor is returned for cursors that were tampered with or have
+// expired. It matches ErrInvalidParams too.
+var ErrInvalidCursor = NewSingleInvalidParams(Rejected, "param:cursor")
+
+var cursorEncoding = base64.RawURLEncoding
+
+// CursorSigner issues opaque pagination cursors, signed so that clients
+// cannot forge or alter them.
+type CursorSigner struct {
+    key []byte
+    ttl time.Duration
+}
+
+// Minimum size of the keys of a CursorSigner, the size of a SHA-256 hash.
+const MinCursorKeySize = 32
+
+// NewCursorSigner returns a signer using key for HMAC-SHA256. Cursors expire
+// after ttl, or never when ttl is 0. It panics if key is shorter than
+// MinCursorKeySize bytes.
+func NewCursorSigner(key []byte, ttl time.Duration) *CursorSigner {
+    if len(key) < MinCursorKeySize {
+        panic("sdtp: cursor key shorter than " + strconv.Itoa(MinCursorKeySize) + " bytes")
+    }
+
+    return &CursorSigner{key: append([]byte(nil), key...), ttl: ttl}
+}
+
+type cursorPayload struct {
+    V   json.RawMessage `json:"v"`
+    Exp int64           `json:"exp,omitempty"`
+}
+
+// Encode returns the cursor holding v, which must be JSON encodable.
+func (s *CursorSigner) Encode(v interface{}) (string, error) {
+    raw, err := json.Marshal(v)
+    if err != nil {
+        return "", err
+    }
+
+    payload := cursorPayload{V: raw}
+    if s.ttl > 0 {
+        payload.Exp = time.Now().Add(s.ttl).Unix()
+    }
+
+    body, err := json.Marshal(payload)
+    if err != nil {
+        return "", err
+    }
+
+    return cursorEncoding.EncodeToString(body) + "." + cursorEncoding.EncodeToString(s.sign(body)), nil
+}
+
+// Decode verifies the cursor and decodes its value into v. Invalid, altered
+// or expired cursors are reported as ErrInvalidCursor.
+func (s *CursorSigner) Decode(cursor string, v interface{}) error {
+    if err := s.decode(cursor, v); err != nil {
+        return &Error{Code: InvalidParams, Data: ErrInvalidCursor.Data, cause: err}
+    }
+
+    return nil
+}
+
+func (s *CursorSigner) decode(cursor string, v interface{}) error {
+    dot := strings.IndexByte(cursor, '.')
+    if dot < 0 {
+        return errors.New("sdtp: malformed cursor")
+    }
+
+    body, err := cursorEncoding.DecodeString(cursor[:dot])
+    if err != nil {
+        return err
+    }
+
+    mac, err := cursorEncoding.DecodeString(cursor[dot + 1:])
+    if err != nil {
+        return err
+    }
+
+    if !hmac.Equal(mac, s.sign(body)) {
+        return errors.New("sdtp: cursor signature mismatch")
+    }
+
+    var payload cursorPayload
+    if err := json.Unmarshal(body, &payload); err != nil {
+        return err
+    }
+
+    if payload.Exp != 0 && time.Now().Unix() > payload.Exp {
+        return errors.New("sdtp: cursor expired")
+    }
+
+    return json.Unmarshal(payload.V, v)
+}
+
+func (s *CursorSigner) sign(body []byte) []byte {
+    mac := hmac.New(sha256.New, s.key)
+    mac.Write(body)
+
+    return mac.Sum(nil)
+}
+
+// EncodeOffset returns the cursor of an offset based position.
+func (s *CursorSigner) EncodeOffset(offset int) (string, error) {
+    return s.Encode(offset)
+}
+
+// Offset returns the position of a page, read from its cursor when one was
+// given, or its offset otherwise.
+func (s *CursorSigner) Offset(page *PageParams) (int, error) {
+    if page.Cursor == "" {
+        return page.Offset, nil
+    }
+
+    var offset int
+    if err := s.Decode(page.Cursor, &offset); err != nil {
+        return 0, err
+    }
+
+    if offset < 0 {
+        return 0, &Error{Code: InvalidParams, Data: ErrInvalidCursor.Data}
+    }
+
+    return offset, nil
+}
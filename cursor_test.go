@@ -0,0 +1,163 @@
+package sdtp
+
+import (
+    "time"
+    "errors"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+var testCursorKey = []byte("0123456789abcdef0123456789abcdef")
+
+type cursorPosition struct {
+    Id   int    `json:"id"`
+    Name string `json:"name"`
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+    s := NewCursorSigner(testCursorKey, time.Hour)
+
+    cursor, err := s.Encode(cursorPosition{Id: 42, Name: "x"})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var position cursorPosition
+    if err := s.Decode(cursor, &position); err != nil || position != (cursorPosition{Id: 42, Name: "x"}) {
+        t.Errorf("Decode = %+v, %v, want the encoded position", position, err)
+    }
+}
+
+// Replaces the byte at i of s by another one of the cursor alphabet.
+func alterCursor(s string, i int) string {
+    c := byte('A')
+    if s[i] == c {
+        c = 'B'
+    }
+
+    return s[:i] + string(c) + s[i + 1:]
+}
+
+// Returns the cursor of body, signed by s.
+func signedCursor(s *CursorSigner, body string) string {
+    return cursorEncoding.EncodeToString([]byte(body)) + "." + cursorEncoding.EncodeToString(s.sign([]byte(body)))
+}
+
+func TestCursorInvalid(t *testing.T) {
+    s := NewCursorSigner(testCursorKey, 0)
+
+    cursor, err := s.Encode(10)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    dot := strings.IndexByte(cursor, '.')
+
+    other, _ := NewCursorSigner([]byte(strings.Repeat("k", MinCursorKeySize)), 0).Encode(10)
+    expired := signedCursor(s, `{"v":10,"exp":` + strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10) + `}`)
+
+    tests := []struct {
+        name   string
+        cursor string
+    }{
+        {"empty", ""},
+        {"no dot", strings.Replace(cursor, ".", "", 1)},
+        {"malformed payload", "%%%" + cursor[dot:]},
+        {"malformed signature", cursor[:dot + 1] + "%%%"},
+        {"altered payload", alterCursor(cursor, 0)},
+        {"altered signature", alterCursor(cursor, dot + 1)},
+        {"swapped parts", cursor[dot + 1:] + "." + cursor[:dot]},
+        {"wrong key", other},
+        {"expired", expired},
+        {"payload not an object", signedCursor(s, "10")},
+    }
+
+    for _, test := range tests {
+        var offset int
+        err := s.Decode(test.cursor, &offset)
+
+        if !errors.Is(err, ErrInvalidCursor) || !errors.Is(err, ErrInvalidParams) {
+            t.Errorf("%s: err = %v, want ErrInvalidCursor", test.name, err)
+        }
+
+        if errors.Is(err, NewSingleInvalidParams(Rejected, "param:offset")) {
+            t.Errorf("%s: err matches another parameter", test.name)
+        }
+
+        if errors.Unwrap(err) == nil {
+            t.Errorf("%s: err has no cause", test.name)
+        }
+    }
+}
+
+func TestCursorTtl(t *testing.T) {
+    s := NewCursorSigner(testCursorKey, time.Hour)
+
+    cursor, _ := s.Encode(1)
+
+    // The expiry travels in the cursor, any signer of the key reads it until then
+    var offset int
+    if err := NewCursorSigner(testCursorKey, 0).Decode(cursor, &offset); err != nil || offset != 1 {
+        t.Errorf("Decode = %d, %v, want 1", offset, err)
+    }
+}
+
+func TestCursorEncodeError(t *testing.T) {
+    if _, err := NewCursorSigner(testCursorKey, 0).Encode(func() {}); err == nil {
+        t.Error("Encode of a func does not fail")
+    }
+}
+
+func TestCursorShortKey(t *testing.T) {
+    defer func() {
+        if recover() == nil {
+            t.Error("NewCursorSigner with a short key does not panic")
+        }
+    }()
+
+    NewCursorSigner(testCursorKey[:MinCursorKeySize - 1], 0)
+}
+
+func TestCursorKeyCopied(t *testing.T) {
+    key := append([]byte(nil), testCursorKey...)
+    s := NewCursorSigner(key, 0)
+
+    cursor, _ := s.Encode(1)
+    key[0] ^= 0xff
+
+    var offset int
+    if err := s.Decode(cursor, &offset); err != nil {
+        t.Errorf("Decode after changing the key given = %v", err)
+    }
+}
+
+func TestCursorOffset(t *testing.T) {
+    s := NewCursorSigner(testCursorKey, 0)
+
+    cursor, _ := s.EncodeOffset(20)
+    negative, _ := s.EncodeOffset(-1)
+
+    tests := []struct {
+        page PageParams
+        want int
+        ok   bool
+    }{
+        {PageParams{Offset: 5}, 5, true},
+        {PageParams{Cursor: cursor}, 20, true},
+        {PageParams{Cursor: negative}, 0, false},
+        {PageParams{Cursor: "x.y"}, 0, false},
+    }
+
+    for _, test := range tests {
+        offset, err := s.Offset(&test.page)
+
+        if offset != test.want || (err == nil) != test.ok {
+            t.Errorf("%+v: Offset = %d, %v, want %d", test.page, offset, err, test.want)
+        }
+
+        if err != nil && !errors.Is(err, ErrInvalidCursor) {
+            t.Errorf("%+v: err = %v, want ErrInvalidCursor", test.page, err)
+        }
+    }
+}
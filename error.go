@@ -0,0 +1,195 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ */
+
+package sdtp
+
+import (
+    "errors"
+    "strconv"
+)
+
+// Error is an SDTP error object, {"code": <CODE>, "message": <MESSAGE>,
+// "data": <DATA>}. An empty Message, or an empty message of a Data entry, is
+// replaced by its translation when the error is sent.
+type Error struct {
+    Code    int
+    Message string
+    Data    E1
+
+    cause error
+}
+
+func (e *Error) Error() string {
+    s := "sdtp: error " + strconv.Itoa(e.Code)
+
+    if e.Message != "" {
+        s += ": " + e.Message
+    }
+
+    if e.cause != nil {
+        s += ": " + e.cause.Error()
+    }
+
+    return s
+}
+
+// Is reports whether target is an *Error with the same code, so that
+// errors.Is(err, ErrNotFound) matches any NotFound error. When target holds
+// parameter errors, e must hold the same codes and locations, so that
+// ErrInvalidCursor only matches invalid cursors.
+func (e *Error) Is(target error) bool {
+    t, ok := target.(*Error)
+    if !ok || t.Code != e.Code {
+        return false
+    }
+
+    if t.Data == nil {
+        return true
+    }
+
+    if len(t.Data) != len(e.Data) {
+        return false
+    }
+
+    for i := range t.Data {
+        if t.Data[i]["code"] != e.Data[i]["code"] || t.Data[i]["location"] != e.Data[i]["location"] {
+            return false
+        }
+    }
+
+    return true
+}
+
+// Unwrap returns the error that caused e, if any.
+func (e *Error) Unwrap() error {
+    return e.cause
+}
+
+/**
+ * Standard errors
+ */
+var (
+    ErrParseError     = &Error{Code: ParseError}
+    ErrInvalidRequest = &Error{Code: InvalidRequest}
+    ErrMethodNotFound = &Error{Code: MethodNotFound}
+    ErrInvalidParams  = &Error{Code: InvalidParams}
+    ErrInternalError  = &Error{Code: InternalError}
+)
+
+/**
+ * Security errors
+ */
+var (
+    ErrUnauthorized = &Error{Code: Unauthorized}
+    ErrForbidden    = &Error{Code: Forbidden}
+)
+
+/**
+ * Resource errors
+ */
+var (
+    ErrNotFound      = &Error{Code: NotFound}
+    ErrNotAcceptable = &Error{Code: NotAcceptable}
+)
+
+/**
+ * Process errors
+ */
+var (
+    ErrConflict            = &Error{Code: Conflict}
+    ErrUnprocessableEntity = &Error{Code: UnprocessableEntity}
+)
+
+func NewError(code int, message string) *Error {
+    return &Error{Code: code, Message: message}
+}
+
+// Returns a new error with the given code caused by err.
+func wrapError(code int, err error) *Error {
+    return &Error{Code: code, cause: err}
+}
+
+func NewParseError() *Error {
+    return &Error{Code: ParseError}
+}
+
+func NewInvalidRequest() *Error {
+    return &Error{Code: InvalidRequest}
+}
+
+func NewMethodNotFound() *Error {
+    return &Error{Code: MethodNotFound}
+}
+
+// NewInvalidParams returns an InvalidParams error holding the parameter
+// errors, as returned by ValidateStructFields.
+func NewInvalidParams(err_map E1) *Error {
+    return &Error{Code: InvalidParams, Data: err_map}
+}
+
+func NewSingleInvalidParams(parameter_error int, location string) *Error {
+    return &Error{Code: InvalidParams, Data: newParamErr(parameter_error, location)}
+}
+
+func NewInternalError() *Error {
+    return &Error{Code: InternalError}
+}
+
+func NewUnauthorized(message string) *Error {
+    return &Error{Code: Unauthorized, Message: message}
+}
+
+func NewSingleUnauthorized(parameter_error int, location string) *Error {
+    return &Error{Code: Unauthorized, Data: newParamErr(parameter_error, location)}
+}
+
+func NewForbidden() *Error {
+    return &Error{Code: Forbidden}
+}
+
+func NewNotFound() *Error {
+    return &Error{Code: NotFound}
+}
+
+func NewNotAcceptable() *Error {
+    return &Error{Code: NotAcceptable}
+}
+
+func NewConflict(message string) *Error {
+    return &Error{Code: Conflict, Message: message}
+}
+
+func NewSingleConflict(location string) *Error {
+    return &Error{Code: Conflict, Data: newParamErr(Rejected, location)}
+}
+
+func NewUnprocessableEntity() *Error {
+    return &Error{Code: UnprocessableEntity}
+}
+
+// Returns the data of an error holding a single parameter error.
+func newParamErr(parameter_error int, location string) E1 {
+    return AddErrorData(NewErrorData(), paramEntry(parameter_error, location))
+}
+
+// Returns a parameter error entry, whose message is translated when sent.
+func paramEntry(parameter_error int, location string) map[string]interface{} {
+    return map[string]interface{}{
+        "code": parameter_error,
+        "location": location,
+    }
+}
+
+// Returns the *Error held by err. Errors that are not SDTP errors are
+// reported as InternalError.
+func asError(err error) *Error {
+    var e *Error
+
+    if errors.As(err, &e) {
+        return e
+    }
+
+    return ErrInternalError
+}
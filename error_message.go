@@ -19,6 +19,7 @@ const (
     
     /* Resource errors */
     NotFound            = -404
+    NotAcceptable       = -406     /* None of the encodings listed in the Accept header can be produced. */
     
     /* Process errors */
     Conflict            = -409
@@ -37,6 +38,7 @@ const (
     security	401 Unauthorized                200     {"id": <ID>, "error": {"code": -401, "message": <MESSAGE>, "data": []}}
     security	403 Forbidden                   200     {"id": <ID>, "error": {"code": -403, "message": <MESSAGE>, "data": []}}
     -	        404 Not Found                   200     {"id": <ID>, "result": null}
+    -	        406 Not Acceptable              200     {"id": <ID>, "error": {"code": -406, "message": <MESSAGE>}}
     validation	409 Conflict                    200     {"id": <ID>, "error": {"code": -409, "message": <MESSAGE>, "data": []}}
     execution   422 Unprocessable Entity        200     {"id": <ID>, "error": {"code": -422, "message": <MESSAGE>}}
     system	    500 Internal Server Error       200     {"id": <ID>, "error": {"code": -32603, "message": <MESSAGE>}}
@@ -70,6 +72,7 @@ const (
    
    Resource Errors
      NotFound
+     NotAcceptable
    
    Process Errors
      Conflict < empty and string >
@@ -0,0 +1,145 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ *
+ * Error objects shared by the HTTP and WebSocket transports.
+ */
+
+package sdtp
+
+import (
+    "net/http"
+)
+
+// Returns the locale used to translate the messages answered to r.
+func langOf(r *http.Request) locale {
+    tr := configOf(r).translator()
+
+    return locale{tr: tr, lang: tr.Lang(r)}
+}
+
+// Returns the translation key of an error code.
+func errKey(code int) string {
+    switch code {
+        case ParseError:
+            return "standard-errors.ParseError"
+        case InvalidRequest:
+            return "standard-errors.InvalidRequest"
+        case MethodNotFound:
+            return "standard-errors.MethodNotFound"
+        case InvalidParams:
+            return "standard-errors.InvalidParams"
+        case InternalError:
+            return "standard-errors.InternalError"
+        case Unauthorized:
+            return "security-errors.Unauthorized"
+        case Forbidden:
+            return "security-errors.Forbidden"
+        case NotFound:
+            return "resource-errors.NotFound"
+        case NotAcceptable:
+            return "resource-errors.NotAcceptable"
+        case Conflict:
+            return "process-errors.Conflict"
+        case UnprocessableEntity:
+            return "process-errors.UnprocessableEntity"
+    }
+
+    return ""
+}
+
+// Returns the translation key of a parameter error code.
+func paramErrKey(parameter_error int) string {
+    switch parameter_error {
+        case Required:
+            return "parameter-errors.Required"
+        case TooLow:
+            return "parameter-errors.TooLow"
+        case LimitExceeded:
+            return "parameter-errors.LimitExceeded"
+        case Rejected:
+            return "parameter-errors.Rejected"
+    }
+
+    return ""
+}
+
+// Builds an error object whose message is the translation of key.
+func newErr(code int, key string, lang locale) map[string]interface{} {
+    return map[string]interface{}{
+        "code": code,
+        "message": lang.t(key, nil),
+    }
+}
+
+// Builds an error object with the given message, falling back to the
+// translation of key when message is empty.
+func newMessageErr(code int, message string, key string, lang locale) map[string]interface{} {
+    if message == "" {
+        message = lang.t(key, nil)
+    }
+
+    return map[string]interface{}{
+        "code": code,
+        "message": message,
+    }
+}
+
+// Builds an error object carrying the parameter errors in data.
+func newDataErr(code int, key string, data E1, lang locale) map[string]interface{} {
+    err_d := newErr(code, key, lang)
+    err_d["data"] = data
+
+    return err_d
+}
+
+// Builds the data of an error object holding a single parameter error.
+func newParamErrData(parameter_error int, location string, lang locale) E1 {
+    var message_parameter_error string
+
+    if key := paramErrKey(parameter_error); key != "" {
+        message_parameter_error = lang.t(key, nil)
+    }
+
+    err_map := NewErrorData()
+    err_map = AddErrorData(err_map, map[string]interface{}{
+            "code": parameter_error,
+            "location": location,
+            "message": message_parameter_error,
+        })
+
+    return err_map
+}
+
+// Builds the error object of err, translating the messages left empty. Errors
+// that are not SDTP errors are reported as InternalError.
+func errorObject(err error, lang locale) map[string]interface{} {
+    e := asError(err)
+
+    err_d := newMessageErr(e.Code, e.Message, errKey(e.Code), lang)
+
+    if e.Data != nil {
+        err_map := make(E1, 0, len(e.Data))
+
+        for _, entry := range e.Data {
+            if message, _ := entry["message"].(string); message == "" {
+                code, _ := entry["code"].(int)
+
+                if key := paramErrKey(code); key != "" {
+                    translated := make(map[string]interface{}, len(entry) + 1)
+                    for k, v := range entry {
+                        translated[k] = v
+                    }
+                    translated["message"] = lang.t(key, nil)
+                    entry = translated
+                }
+            }
+
+            err_map = append(err_map, entry)
+        }
+
+        err_d["data"] = err_map
+    }
+
+    return err_d
+}
@@ -0,0 +1,135 @@
+package sdtp
+
+import (
+    "fmt"
+    "errors"
+    "reflect"
+    "testing"
+)
+
+func TestErrorString(t *testing.T) {
+    tests := []struct {
+        err  *Error
+        want string
+    }{
+        {NewNotFound(), "sdtp: error -404"},
+        {NewConflict("taken"), "sdtp: error -409: taken"},
+        {wrapError(InvalidParams, errors.New("bad json")), "sdtp: error -32602: bad json"},
+        {&Error{Code: Conflict, Message: "taken", cause: errors.New("unique")}, "sdtp: error -409: taken: unique"},
+    }
+
+    for _, test := range tests {
+        if got := test.err.Error(); got != test.want {
+            t.Errorf("Error() = %q, want %q", got, test.want)
+        }
+    }
+}
+
+func TestErrorIs(t *testing.T) {
+    cursor := NewSingleInvalidParams(Rejected, "param:cursor")
+
+    tests := []struct {
+        err    error
+        target error
+        want   bool
+    }{
+        {NewNotFound(), ErrNotFound, true},
+        {NewConflict("taken"), ErrConflict, true},
+        {NewNotFound(), ErrConflict, false},
+        {errors.New("not found"), ErrNotFound, false},
+        {fmt.Errorf("loading: %w", NewNotFound()), ErrNotFound, true},
+        // Parameter errors match on their codes and locations
+        {cursor, ErrInvalidParams, true},
+        {cursor, ErrInvalidCursor, true},
+        {NewSingleInvalidParams(Required, "param:cursor"), ErrInvalidCursor, false},
+        {NewSingleInvalidParams(Rejected, "param:offset"), ErrInvalidCursor, false},
+        {NewInvalidParams(append(newParamErr(Rejected, "param:cursor"), paramEntry(Required, "param:limit"))), ErrInvalidCursor, false},
+        {ErrInvalidParams, ErrInvalidCursor, false},
+        // Messages are ignored
+        {&Error{Code: InvalidParams, Data: E1{{"code": Rejected, "location": "param:cursor", "message": "x"}}}, ErrInvalidCursor, true},
+        {NewSingleConflict("field:email"), NewSingleInvalidParams(Rejected, "field:email"), false},
+    }
+
+    for _, test := range tests {
+        if got := errors.Is(test.err, test.target); got != test.want {
+            t.Errorf("errors.Is(%v, %v) = %v, want %v", test.err, test.target, got, test.want)
+        }
+    }
+}
+
+func TestErrorUnwrap(t *testing.T) {
+    cause := errors.New("bad json")
+
+    if err := wrapError(InvalidParams, cause); !errors.Is(err, cause) || errors.Unwrap(err) != cause {
+        t.Errorf("%v does not unwrap to its cause", err)
+    }
+
+    if err := NewNotFound(); err.Unwrap() != nil {
+        t.Errorf("Unwrap = %v, want nil", err.Unwrap())
+    }
+}
+
+func TestAsError(t *testing.T) {
+    conflict := NewConflict("taken")
+
+    tests := []struct {
+        err  error
+        want *Error
+    }{
+        {conflict, conflict},
+        {fmt.Errorf("saving: %w", conflict), conflict},
+        {errors.New("database is down"), ErrInternalError},
+    }
+
+    for _, test := range tests {
+        if got := asError(test.err); got != test.want {
+            t.Errorf("asError(%v) = %v, want %v", test.err, got, test.want)
+        }
+    }
+}
+
+func TestErrorObject(t *testing.T) {
+    lang := locale{tr: keyTranslator{}}
+
+    tests := []struct {
+        err  error
+        want map[string]interface{}
+    }{
+        {NewNotFound(), map[string]interface{}{"code": NotFound, "message": "resource-errors.NotFound"}},
+        {NewConflict("taken"), map[string]interface{}{"code": Conflict, "message": "taken"}},
+        {fmt.Errorf("saving: %w", NewConflict("")), map[string]interface{}{"code": Conflict, "message": "process-errors.Conflict"}},
+        // The message of other errors is not disclosed
+        {errors.New("database is down"), map[string]interface{}{"code": InternalError, "message": "standard-errors.InternalError"}},
+        {NewInvalidParams(E1{
+            paramEntry(Required, "param:name"),
+            {"code": Rejected, "location": "param:email", "message": "is taken"},
+            paramEntry(99, "param:other"),
+        }), map[string]interface{}{
+            "code": InvalidParams,
+            "message": "standard-errors.InvalidParams",
+            "data": E1{
+                {"code": Required, "location": "param:name", "message": "parameter-errors.Required"},
+                {"code": Rejected, "location": "param:email", "message": "is taken"},
+                // Unknown codes have no message to translate
+                {"code": 99, "location": "param:other"},
+            },
+        }},
+    }
+
+    for _, test := range tests {
+        if got := errorObject(test.err, lang); !reflect.DeepEqual(got, test.want) {
+            t.Errorf("errorObject(%v) = %v, want %v", test.err, got, test.want)
+        }
+    }
+}
+
+func TestErrorObjectKeepsData(t *testing.T) {
+    err := NewSingleInvalidParams(Required, "param:name")
+
+    errorObject(err, locale{tr: keyTranslator{}})
+
+    // Errors are often shared variables, translating must not alter them
+    if _, ok := err.Data[0]["message"]; ok {
+        t.Errorf("data = %v, want it left untranslated", err.Data)
+    }
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ */
+
+package sdtp
+
+import (
+    "time"
+    "context"
+    "net/http"
+)
+
+// HandlerFunc handles a single SDTP call, whose params are read with
+// req.BindParams. The returned data is sent as the result, a non nil error is
+// sent with SendHttpError.
+type HandlerFunc func(ctx context.Context, req *Request) (interface{}, error)
+
+// Handler adapts fn to an http.Handler that decodes the request, calls fn
+// and sends its result or error. The context given to fn is the one of the
+// HTTP request, the request itself is available with HttpRequestFromContext.
+// As fn answers any method, responses are logged without the method.
+func Handler(fn HandlerFunc) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start_time := time.Now()
+
+        r = withTiming(r)
+
+        req, ok := ReadHttpRequest(start_time, w, r)
+        if !ok {
+            return
+        }
+
+        r = withRequest(r, req, "")
+
+        stop := timingOf(r).Start(PhaseHandler)
+        data, err := fn(withHttpRequest(r), req)
+        stop()
+
+        if req.IsNotification() {
+            SendHttpNoContent(start_time, w, r)
+            return
+        }
+
+        if err != nil {
+            SendHttpError(err, start_time, w, r)
+            return
+        }
+
+        SendHttpData(data, start_time, w, r)
+    })
+}
+
+// Handle registers a HandlerFunc for the given method.
+func (m *Mux) Handle(method string, fn HandlerFunc) {
+    if fn == nil {
+        panic("sdtp: nil handler for method " + method)
+    }
+
+    m.HandleFunc(method, func(req *Request, r *http.Request) (interface{}, error) {
+        return fn(withHttpRequest(r), req)
+    })
+}
+
+// HttpRequestFromContext returns the HTTP request, or the WebSocket upgrade
+// request, a HandlerFunc is answering.
+func HttpRequestFromContext(ctx context.Context) *http.Request {
+    r, _ := ctx.Value(httpRequestKey).(*http.Request)
+
+    return r
+}
+
+// Returns the context of r, carrying r itself.
+func withHttpRequest(r *http.Request) context.Context {
+    return context.WithValue(r.Context(), httpRequestKey, r)
+}
@@ -0,0 +1,124 @@
+package sdtp
+
+import (
+    "errors"
+    "testing"
+    "context"
+    "net/http"
+    "net/http/httptest"
+)
+
+func TestHandlerNotification(t *testing.T) {
+    calls := 0
+
+    h := Handler(func(ctx context.Context, req *Request) (interface{}, error) {
+        calls++
+        return nil, errors.New("not reported")
+    })
+
+    w := serveJson(h, `{"method": "create"}`)
+
+    if w.Code != http.StatusNoContent || w.Body.Len() != 0 || calls != 1 {
+        t.Errorf("status = %d, body = %q, calls = %d, want 204 without body and the handler run", w.Code, w.Body.Bytes(), calls)
+    }
+
+    // A null id is not a notification
+    var response map[string]interface{}
+    if decodeJson(t, serveJson(h, `{"id": null, "method": "create"}`), &response); responseCode(response) != InternalError {
+        t.Errorf("response = %v, want InternalError", response)
+    }
+}
+
+type createParams struct {
+    Name string `json:"name"`
+}
+
+// Answers with the name of its params, or fails for an empty name.
+func createHandler(ctx context.Context, req *Request) (interface{}, error) {
+    var params createParams
+    if err := req.BindParams(&params); err != nil {
+        return nil, err
+    }
+
+    if params.Name == "" {
+        return nil, NewSingleInvalidParams(Required, "param:name")
+    }
+
+    if HttpRequestFromContext(ctx) == nil {
+        return nil, errors.New("no HTTP request")
+    }
+
+    return req.Method + " " + params.Name, nil
+}
+
+func TestHandler(t *testing.T) {
+    tests := []struct {
+        body   string
+        result interface{}
+        code   int
+    }{
+        {`{"id": 1, "method": "create", "params": {"name": "a"}}`, "create a", 0},
+        {`{"id": 1, "method": "create", "params": {}}`, nil, InvalidParams},
+        {`{"id": 1, "method": "create", "params": {"name": 1}}`, nil, InvalidParams},
+        // Any method is answered
+        {`{"id": 1, "method": "other", "params": {"name": "b"}}`, "other b", 0},
+    }
+
+    h := Handler(createHandler)
+
+    for _, test := range tests {
+        var response map[string]interface{}
+        decodeJson(t, serveJson(h, test.body), &response)
+
+        if response["id"] != float64(1) || response["result"] != test.result || responseCode(response) != test.code {
+            t.Errorf("%s: response = %v", test.body, response)
+        }
+    }
+}
+
+func TestHandlerContext(t *testing.T) {
+    type key struct{}
+
+    var got *http.Request
+    var value interface{}
+
+    h := Handler(func(ctx context.Context, req *Request) (interface{}, error) {
+        got, value = HttpRequestFromContext(ctx), ctx.Value(key{})
+        return "ok", nil
+    })
+
+    r := newJsonRequest(`{"id": 1, "method": "create"}`)
+    h.ServeHTTP(httptest.NewRecorder(), r.WithContext(context.WithValue(r.Context(), key{}, "v")))
+
+    // The context is the one of the HTTP request
+    if got == nil || got.URL.Path != "/" || value != "v" {
+        t.Errorf("HttpRequestFromContext = %v, value = %v", got, value)
+    }
+}
+
+func TestMuxHandle(t *testing.T) {
+    m := NewMux()
+    m.Handle("create", createHandler)
+
+    var response map[string]interface{}
+    if decodeJson(t, serveJson(m, `{"id": 1, "method": "create", "params": {"name": "a"}}`), &response); response["result"] != "create a" {
+        t.Errorf("response = %v, want the result of the handler", response)
+    }
+
+    // WebSocket calls get the upgrade request
+    conn := dialWs(t, NewWsHandler(m))
+    writeWs(t, conn, `{"id": 2, "method": "create", "params": {"name": "b"}}`)
+
+    readWs(t, conn, &response)
+    if response["result"] != "create b" {
+        t.Errorf("response = %v, want the result of the handler", response)
+    }
+
+    defer func() {
+        if recover() == nil {
+            t.Error("Handle of a nil handler does not panic")
+        }
+    }()
+
+    m.Handle("nil", nil)
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ */
+
+// Package ini translates the SDTP messages with the INI files of go-cfg_ini
+// and i18n_ini.
+//
+// Besides the "standard-errors", "security-errors", "resource-errors",
+// "process-errors" and "parameter-errors" sections, the messages of the
+// built-in validators are read from a "validation-errors" section, with
+// "{name}" placeholders for their args, e.g.
+//
+//  [validation-errors]
+//  Required       = is required
+//  StringTooShort = must be at least {min} characters
+//  StringTooLong  = must be at most {max} characters
+//  NumberTooLow   = must be at least {min}
+//  NumberTooHigh  = must be at most {max}
+//  Email          = must be a valid email address
+//  Date           = must be a valid date
+//  Username       = must be a valid username
+//  Type           = must be a {type}
+//  EqField        = must be equal to {other}
+//  NeField        = must differ from {other}
+//  GtField        = must be greater than {other}
+//  GteField       = must be greater than or equal to {other}
+//  LtField        = must be less than {other}
+//  LteField       = must be less than or equal to {other}
+//  AfterField     = must be after {other}
+//  NotBeforeField = must not be before {other}
+//  BeforeField    = must be before {other}
+//  NotAfterField  = must not be after {other}
+//  RequiredIf     = is required when {other} is {value}
+//
+// Every message also gets the {field} arg. Files lacking the section answer
+// the messages of the "parameter-errors" section, which get the same args.
+package ini
+
+import (
+    "net/http"
+
+    "github.com/iurybraun/sdtp"
+    "github.com/iurybraun/go-cfg_ini"
+    "github.com/iurybraun/i18n_ini"
+)
+
+// Translator reads the language of a request with cfg_ini.GetLang and the
+// messages with i18n_ini.LoadTr.
+//
+//  config := &sdtp.Config{Translator: ini.Translator{}}
+type Translator struct{}
+
+var _ sdtp.Translator = Translator{}
+
+func (Translator) Lang(r *http.Request) string {
+    return cfg_ini.GetLang(r)
+}
+
+func (Translator) T(lang string, key string, args map[string]interface{}) string {
+    return sdtp.Interpolate(i18n_ini.LoadTr(lang, key), args)
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ */
+
+package sdtp
+
+import (
+    "time"
+    "context"
+    "log/slog"
+    "net/http"
+)
+
+// LogEntry describes a response sent.
+type LogEntry struct {
+    // Method of the call, "" when no handler is registered for it, so that
+    // clients cannot make up metrics labels.
+    Method string
+    Id     interface{}
+
+    // Code is the SDTP error code, 0 when a result was sent.
+    Code int
+
+    // Batch is the number of responses of a batch, 0 for a single call.
+    Batch int
+
+    // Size of the body in bytes and media type of its encoding, empty when
+    // there is no body.
+    Size     int
+    Encoding string
+
+    // Elapsed time since start_time was taken.
+    Elapsed time.Duration
+
+    // Calls answered by a batch, observed by the Metrics instead of the
+    // batch itself, each with the time its handler took.
+    calls []*LogEntry
+}
+
+// Logger is called with every response sent. r is the request answered, or
+// the upgrade request of a WebSocket.
+type Logger interface {
+    Log(r *http.Request, e *LogEntry)
+}
+
+// LoggerFunc adapts a function to a Logger.
+type LoggerFunc func(r *http.Request, e *LogEntry)
+
+func (f LoggerFunc) Log(r *http.Request, e *LogEntry) {
+    f(r, e)
+}
+
+// SlogLogger logs the responses to a log/slog logger: results at Info
+// level, errors at Warn level and internal errors at Error level.
+func SlogLogger(l *slog.Logger) Logger {
+    return LoggerFunc(func(r *http.Request, e *LogEntry) {
+        level := slog.LevelInfo
+
+        switch {
+            case e.Code == InternalError:
+                level = slog.LevelError
+            case e.Code != 0:
+                level = slog.LevelWarn
+        }
+
+        ctx := context.Background()
+        if r != nil {
+            ctx = r.Context()
+        }
+
+        l.LogAttrs(ctx, level, "sdtp response",
+            slog.String("method", e.Method),
+            slog.Any("id", e.Id),
+            slog.Int("code", e.Code),
+            slog.Int("batch", e.Batch),
+            slog.Int("size", e.Size),
+            slog.String("encoding", e.Encoding),
+            slog.Duration("elapsed", e.Elapsed),
+        )
+    })
+}
+
+// Calls the Logger and the Metrics of the Config r is answered with, if any.
+func observeResponse(r *http.Request, start_time time.Time, e *LogEntry) {
+    c := configOf(r)
+    if c.Logger == nil && c.Metrics == nil {
+        return
+    }
+
+    e.Elapsed = time.Since(start_time)
+
+    if c.Logger != nil {
+        c.Logger.Log(r, e)
+    }
+
+    if c.Metrics == nil {
+        return
+    }
+
+    if e.calls == nil {
+        c.Metrics.Observe(e)
+        return
+    }
+
+    for _, call := range e.calls {
+        call.Encoding = e.Encoding
+        c.Metrics.Observe(call)
+    }
+}
+
+// Returns the code of an error object, 0 when it has none.
+func codeOf(err_d interface{}) int {
+    if m, ok := err_d.(map[string]interface{}); ok {
+        code, _ := m["code"].(int)
+        return code
+    }
+
+    return 0
+}
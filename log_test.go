@@ -0,0 +1,139 @@
+package sdtp
+
+import (
+    "time"
+    "bytes"
+    "testing"
+    "log/slog"
+    "net/http"
+    "encoding/json"
+    "net/http/httptest"
+)
+
+// Returns a Config appending the entries logged to logged.
+func newLogConfig(logged *[]*LogEntry) *Config {
+    return &Config{
+        Logger: LoggerFunc(func(r *http.Request, e *LogEntry) {
+            *logged = append(*logged, e)
+        }),
+    }
+}
+
+func TestObserveResponse(t *testing.T) {
+    tests := []struct {
+        body string
+        want LogEntry
+    }{
+        {`{"id": 1, "method": "echo", "params": [1]}`, LogEntry{Method: "echo", Id: int64(1), Encoding: "application/json"}},
+        {`{"id": "a", "method": "fail"}`, LogEntry{Method: "fail", Id: "a", Code: NotFound, Encoding: "application/json"}},
+        // Unregistered methods are not logged
+        {`{"id": 2, "method": "nosuch"}`, LogEntry{Id: int64(2), Code: MethodNotFound, Encoding: "application/json"}},
+        {`{"id": 3, "method": ""}`, LogEntry{Id: int64(3), Code: InvalidRequest, Encoding: "application/json"}},
+        {`{"id": 4,`, LogEntry{Code: ParseError, Encoding: "application/json"}},
+        // Notifications have no body
+        {`{"method": "echo"}`, LogEntry{Method: "echo"}},
+    }
+
+    for _, test := range tests {
+        var logged []*LogEntry
+        w := serveJson(newLogConfig(&logged).Wrap(newTestMux()), test.body)
+
+        if len(logged) != 1 {
+            t.Errorf("%s: logged %d entries, want 1", test.body, len(logged))
+            continue
+        }
+
+        e := logged[0]
+        if e.Method != test.want.Method || e.Id != test.want.Id || e.Code != test.want.Code || e.Encoding != test.want.Encoding || e.Batch != 0 {
+            t.Errorf("%s: logged %+v, want %+v", test.body, e, test.want)
+        }
+
+        if e.Size != w.Body.Len() || e.Elapsed <= 0 {
+            t.Errorf("%s: size = %d, elapsed = %v, want %d and the time taken", test.body, e.Size, e.Elapsed, w.Body.Len())
+        }
+    }
+}
+
+func TestObserveResponseElapsed(t *testing.T) {
+    var logged []*LogEntry
+    serveJson(newLogConfig(&logged).Wrap(newTestMux()), `{"id": 1, "method": "sleep", "params": {"ms": 20}}`)
+
+    if len(logged) != 1 || logged[0].Elapsed < 20 * time.Millisecond {
+        t.Errorf("logged %v, want the time of the handler included", logged)
+    }
+}
+
+func TestObserveWsResponse(t *testing.T) {
+    var logged []*LogEntry
+    done := make(chan bool, 1)
+
+    c := newLogConfig(&logged)
+    logger := c.Logger
+    c.Logger = LoggerFunc(func(r *http.Request, e *LogEntry) {
+        logger.Log(r, e)
+        done <- true
+    })
+
+    conn := dialWs(t, c.Wrap(NewWsHandler(newTestMux())))
+    writeWs(t, conn, `{"id": 1, "method": "echo", "params": ["abc"]}`)
+
+    var response map[string]interface{}
+    readWs(t, conn, &response)
+    <-done
+
+    // WebSocket responses are encoded with the codec of the connection
+    e := logged[0]
+    if e.Method != "echo" || e.Id != int64(1) || e.Encoding != "application/json" || e.Size == 0 {
+        t.Errorf("logged %+v", e)
+    }
+}
+
+func TestSlogLogger(t *testing.T) {
+    tests := []struct {
+        e     LogEntry
+        level string
+    }{
+        {LogEntry{Method: "echo", Id: "a", Size: 12, Encoding: "application/json", Elapsed: time.Millisecond}, "INFO"},
+        {LogEntry{Method: "fail", Id: 1, Code: NotFound, Encoding: "application/msgpack"}, "WARN"},
+        {LogEntry{Batch: 3, Code: InternalError}, "ERROR"},
+    }
+
+    for _, test := range tests {
+        var b bytes.Buffer
+        SlogLogger(slog.New(slog.NewJSONHandler(&b, nil))).Log(httptest.NewRequest("POST", "/", nil), &test.e)
+
+        var record map[string]interface{}
+        if err := json.Unmarshal(b.Bytes(), &record); err != nil {
+            t.Fatalf("%v: %s", err, b.Bytes())
+        }
+
+        want := map[string]interface{}{
+            "level": test.level,
+            "msg": "sdtp response",
+            "method": test.e.Method,
+            "code": float64(test.e.Code),
+            "batch": float64(test.e.Batch),
+            "size": float64(test.e.Size),
+            "encoding": test.e.Encoding,
+            "elapsed": float64(test.e.Elapsed),
+        }
+
+        for key, value := range want {
+            if record[key] != value {
+                t.Errorf("%+v: %s = %v, want %v", test.e, key, record[key], value)
+            }
+        }
+
+        if _, ok := record["id"]; !ok {
+            t.Errorf("%+v: record = %v, want the id", test.e, record)
+        }
+    }
+
+    // Loggers may be called without request
+    var b bytes.Buffer
+    SlogLogger(slog.New(slog.NewJSONHandler(&b, nil))).Log(nil, &LogEntry{})
+
+    if b.Len() == 0 {
+        t.Error("nothing logged without request")
+    }
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ *
+ * sdtp_responses_total{method, code, encoding}
+ * sdtp_response_duration_seconds{method, code, encoding}, histogram
+ */
+
+package sdtp
+
+import (
+    "io"
+    "fmt"
+    "sort"
+    "sync"
+    "strconv"
+    "strings"
+    "net/http"
+)
+
+// Metrics is called with every response sent, after the Logger. A batch is
+// observed once per call it answers, with the method and code of that call.
+// Responses sent on a WebSocket carry the method of their call, except those
+// sent directly with the SendWs* functions.
+type Metrics interface {
+    Observe(e *LogEntry)
+}
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency histogram
+// buckets of a MetricsCollector.
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// MetricsCollector counts the responses sent and their latency in memory,
+// by method, error code and encoding. It serves them in the Prometheus text
+// exposition format.
+type MetricsCollector struct {
+    buckets []float64
+
+    mu     sync.Mutex
+    series map[metricsLabels]*metricsSeries
+}
+
+type metricsLabels struct {
+    method   string
+    code     int
+    encoding string
+}
+
+type metricsSeries struct {
+    counts []uint64 // Per bucket, not cumulative, the last one is +Inf
+    count  uint64
+    sum    float64
+}
+
+// NewMetricsCollector returns a collector using the given histogram bucket
+// upper bounds, in seconds, or DefaultBuckets when none are given.
+func NewMetricsCollector(buckets ...float64) *MetricsCollector {
+    if len(buckets) == 0 {
+        buckets = DefaultBuckets
+    }
+
+    buckets = append([]float64(nil), buckets...)
+    sort.Float64s(buckets)
+
+    return &MetricsCollector{buckets: buckets, series: make(map[metricsLabels]*metricsSeries)}
+}
+
+func (m *MetricsCollector) Observe(e *LogEntry) {
+    labels := metricsLabels{method: e.Method, code: e.Code, encoding: encodingName(e.Encoding)}
+    seconds := e.Elapsed.Seconds()
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    s := m.series[labels]
+    if s == nil {
+        s = &metricsSeries{counts: make([]uint64, len(m.buckets) + 1)}
+        m.series[labels] = s
+    }
+
+    s.counts[sort.SearchFloat64s(m.buckets, seconds)]++
+    s.count++
+    s.sum += seconds
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *MetricsCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+    m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *MetricsCollector) WriteTo(w io.Writer) (int64, error) {
+    var b strings.Builder
+
+    m.mu.Lock()
+
+    keys := make([]metricsLabels, 0, len(m.series))
+    for labels := range m.series {
+        keys = append(keys, labels)
+    }
+
+    sort.Slice(keys, func(i, j int) bool {
+        a, b := keys[i], keys[j]
+
+        if a.method != b.method {
+            return a.method < b.method
+        }
+        if a.code != b.code {
+            return a.code < b.code
+        }
+        return a.encoding < b.encoding
+    })
+
+    b.WriteString("# HELP sdtp_responses_total Number of SDTP responses sent.\n")
+    b.WriteString("# TYPE sdtp_responses_total counter\n")
+
+    for _, labels := range keys {
+        fmt.Fprintf(&b, "sdtp_responses_total{%s} %d\n", labels, m.series[labels].count)
+    }
+
+    b.WriteString("# HELP sdtp_response_duration_seconds Time taken to answer SDTP calls.\n")
+    b.WriteString("# TYPE sdtp_response_duration_seconds histogram\n")
+
+    for _, labels := range keys {
+        s := m.series[labels]
+
+        var cumulative uint64
+        for i, upper := range m.buckets {
+            cumulative += s.counts[i]
+            fmt.Fprintf(&b, "sdtp_response_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatFloat(upper), cumulative)
+        }
+
+        fmt.Fprintf(&b, "sdtp_response_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, s.count)
+        fmt.Fprintf(&b, "sdtp_response_duration_seconds_sum{%s} %s\n", labels, formatFloat(s.sum))
+        fmt.Fprintf(&b, "sdtp_response_duration_seconds_count{%s} %d\n", labels, s.count)
+    }
+
+    m.mu.Unlock()
+
+    n, err := io.WriteString(w, b.String())
+
+    return int64(n), err
+}
+
+// Formats the labels of a series, without the braces.
+func (l metricsLabels) String() string {
+    return "method=\"" + escapeLabel(l.method) + "\",code=\"" + strconv.Itoa(l.code) + "\",encoding=\"" + escapeLabel(l.encoding) + "\""
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+    return labelEscaper.Replace(v)
+}
+
+func formatFloat(f float64) string {
+    return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Returns the short name of an encoding, as "json" for "application/json".
+func encodingName(media_type string) string {
+    return media_type[strings.IndexByte(media_type, '/') + 1:]
+}
@@ -0,0 +1,139 @@
+package sdtp
+
+import (
+    "time"
+    "strings"
+    "testing"
+    "net/http"
+    "net/http/httptest"
+)
+
+func TestMetricsCollectorExposition(t *testing.T) {
+    m := NewMetricsCollector(0.01, 0.1)
+
+    m.Observe(&LogEntry{Method: "get", Encoding: "application/json", Elapsed: 5 * time.Millisecond})
+    m.Observe(&LogEntry{Method: "get", Encoding: "application/json", Elapsed: 50 * time.Millisecond})
+    m.Observe(&LogEntry{Method: "get", Code: NotFound, Encoding: "application/msgpack", Elapsed: 500 * time.Millisecond})
+
+    var b strings.Builder
+    if _, err := m.WriteTo(&b); err != nil {
+        t.Fatal(err)
+    }
+
+    want := `# HELP sdtp_responses_total Number of SDTP responses sent.
+# TYPE sdtp_responses_total counter
+sdtp_responses_total{method="get",code="-404",encoding="msgpack"} 1
+sdtp_responses_total{method="get",code="0",encoding="json"} 2
+# HELP sdtp_response_duration_seconds Time taken to answer SDTP calls.
+# TYPE sdtp_response_duration_seconds histogram
+sdtp_response_duration_seconds_bucket{method="get",code="-404",encoding="msgpack",le="0.01"} 0
+sdtp_response_duration_seconds_bucket{method="get",code="-404",encoding="msgpack",le="0.1"} 0
+sdtp_response_duration_seconds_bucket{method="get",code="-404",encoding="msgpack",le="+Inf"} 1
+sdtp_response_duration_seconds_sum{method="get",code="-404",encoding="msgpack"} 0.5
+sdtp_response_duration_seconds_count{method="get",code="-404",encoding="msgpack"} 1
+sdtp_response_duration_seconds_bucket{method="get",code="0",encoding="json",le="0.01"} 1
+sdtp_response_duration_seconds_bucket{method="get",code="0",encoding="json",le="0.1"} 2
+sdtp_response_duration_seconds_bucket{method="get",code="0",encoding="json",le="+Inf"} 2
+sdtp_response_duration_seconds_sum{method="get",code="0",encoding="json"} 0.055
+sdtp_response_duration_seconds_count{method="get",code="0",encoding="json"} 2
+`
+
+    if b.String() != want {
+        t.Errorf("exposition:\n%s\nwant:\n%s", b.String(), want)
+    }
+}
+
+func TestMetricsCollectorEscapesLabels(t *testing.T) {
+    m := NewMetricsCollector()
+
+    m.Observe(&LogEntry{Method: "a\"b\\c\nd"})
+
+    var b strings.Builder
+    m.WriteTo(&b)
+
+    if !strings.Contains(b.String(), `method="a\"b\\c\nd"`) {
+        t.Errorf("exposition does not escape the method label:\n%s", b.String())
+    }
+}
+
+func TestMetricsCollectorServeHTTP(t *testing.T) {
+    m := NewMetricsCollector()
+    m.Observe(&LogEntry{Method: "get", Encoding: "application/json"})
+
+    w := httptest.NewRecorder()
+    m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+    if content_type := w.Header().Get("Content-Type"); !strings.HasPrefix(content_type, "text/plain; version=0.0.4") {
+        t.Errorf("Content-Type = %q, want the text exposition format", content_type)
+    }
+
+    if !strings.Contains(w.Body.String(), `sdtp_responses_total{method="get",code="0",encoding="json"} 1`) {
+        t.Errorf("body misses the response counter:\n%s", w.Body.String())
+    }
+}
+
+func TestMetricsUnknownMethodsShareALabel(t *testing.T) {
+    m := NewMetricsCollector()
+    h := (&Config{Metrics: m}).Wrap(newTestMux())
+
+    for _, method := range []string{"echo", "missing-1", "missing-2"} {
+        r := httptest.NewRequest("POST", "/", strings.NewReader(`{"id": 1, "method": "` + method + `", "params": []}`))
+        r.Header.Set("Content-Type", "application/json")
+        r.Header.Set("Accept", "application/json")
+
+        h.ServeHTTP(httptest.NewRecorder(), r)
+    }
+
+    var b strings.Builder
+    m.WriteTo(&b)
+
+    if strings.Contains(b.String(), "missing") {
+        t.Errorf("exposition labels unregistered methods:\n%s", b.String())
+    }
+
+    for _, line := range []string{
+        `sdtp_responses_total{method="",code="-32601",encoding="json"} 2`,
+        `sdtp_responses_total{method="echo",code="0",encoding="json"} 1`,
+    } {
+        if !strings.Contains(b.String(), line) {
+            t.Errorf("exposition misses %s:\n%s", line, b.String())
+        }
+    }
+}
+
+func TestMetricsObserveBatchCalls(t *testing.T) {
+    m := NewMetricsCollector()
+    var logged []*LogEntry
+
+    h := (&Config{
+        Metrics: m,
+        Logger: LoggerFunc(func(r *http.Request, e *LogEntry) { logged = append(logged, e) }),
+    }).Wrap(newTestMux())
+
+    r := httptest.NewRequest("POST", "/", strings.NewReader(`[
+        {"id": 1, "method": "echo", "params": []},
+        {"id": 2, "method": "fail"},
+        {"id": 3}
+    ]`))
+    r.Header.Set("Content-Type", "application/json")
+    r.Header.Set("Accept", "application/json")
+
+    h.ServeHTTP(httptest.NewRecorder(), r)
+
+    if len(logged) != 1 || logged[0].Batch != 3 {
+        t.Errorf("logged %v, want a single entry for the batch", logged)
+    }
+
+    var b strings.Builder
+    m.WriteTo(&b)
+
+    for _, line := range []string{
+        `sdtp_responses_total{method="echo",code="0",encoding="json"} 1`,
+        `sdtp_responses_total{method="fail",code="-404",encoding="json"} 1`,
+        `sdtp_responses_total{method="",code="-32600",encoding="json"} 1`,
+    } {
+        if !strings.Contains(b.String(), line) {
+            t.Errorf("exposition misses %s:\n%s", line, b.String())
+        }
+    }
+}
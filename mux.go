@@ -0,0 +1,202 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ */
+
+package sdtp
+
+import (
+    "time"
+    "sync"
+    "net/http"
+)
+
+// MethodFunc handles a single SDTP method. The returned data is sent as the
+// result of the call, a non nil error is answered with its error object, or
+// InternalError when it is not an *Error.
+type MethodFunc func(req *Request, r *http.Request) (interface{}, error)
+
+// Mux dispatches SDTP requests to the handlers registered by method name.
+type Mux struct {
+    mu      sync.RWMutex
+    methods map[string]MethodFunc
+}
+
+func NewMux() *Mux {
+    return &Mux{methods: make(map[string]MethodFunc)}
+}
+
+// HandleFunc registers the handler for the given method. It panics if the
+// method is empty or already registered.
+func (m *Mux) HandleFunc(method string, fn MethodFunc) {
+    if method == "" {
+        panic("sdtp: empty method name")
+    }
+    if fn == nil {
+        panic("sdtp: nil handler for method " + method)
+    }
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if _, exists := m.methods[method]; exists {
+        panic("sdtp: multiple registrations for method " + method)
+    }
+
+    m.methods[method] = fn
+}
+
+// Returns the handler registered for method, or nil.
+func (m *Mux) handler(method string) MethodFunc {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+
+    return m.methods[method]
+}
+
+// Returns method when a handler is registered for it, or "" so that the
+// methods logged and labelling metrics are bounded by the registered ones.
+func (m *Mux) methodName(method string) string {
+    if m.handler(method) == nil {
+        return ""
+    }
+
+    return method
+}
+
+// ServeHTTP answers a single request or, when the body is an array, a batch
+// of requests with an array of responses. Notifications are dispatched but
+// left out of the response, a call made only of notifications is answered
+// with 204 No Content. Calls expecting a response are answered NotAcceptable
+// without running any handler when the client accepts none of the codecs.
+func (m *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    start_time := time.Now()
+
+    r = withTiming(r)
+
+    body, codec, err := decodeHttpBody(r)
+    if err != nil {
+        sendHttpDecodeError(err, start_time, w, r)
+        return
+    }
+
+    if batch, ok := body.([]interface{}); ok {
+        m.serveBatch(batch, codec, start_time, w, r)
+        return
+    }
+
+    req, err := parseEnvelope(body)
+    r = withRequest(r, req, m.methodName(req.Method))
+
+    if err != nil {
+        SendHttpInvalidRequest(start_time, w, r)
+        return
+    }
+
+    req.codec = codec
+
+    if !req.IsNotification() && !acceptHttp(start_time, w, r) {
+        return
+    }
+
+    data, err_d := m.dispatch(req, r)
+    if req.IsNotification() {
+        SendHttpNoContent(start_time, w, r)
+        return
+    }
+
+    if err_d != nil {
+        sendHttpErr(err_d, start_time, w, r)
+        return
+    }
+
+    SendHttpData(data, start_time, w, r)
+}
+
+// Answers every call of a batch, in order, with a single array of responses.
+func (m *Mux) serveBatch(batch []interface{}, codec Codec, start_time time.Time, w http.ResponseWriter, r *http.Request) {
+    if len(batch) == 0 {
+        SendHttpInvalidRequest(start_time, w, r)
+        return
+    }
+
+    if !acceptHttp(start_time, w, r) {
+        return
+    }
+
+    results, calls := m.dispatchBatch(batch, codec, r)
+
+    if len(results) == 0 {
+        SendHttpNoContent(start_time, w, r)
+        return
+    }
+
+    if err := writeHttp(results, &LogEntry{Batch: len(results), calls: calls}, start_time, w, r); err != nil {
+        SendHttpInternalError(start_time, w, r)
+        return
+    }
+}
+
+// Invokes the handler of every call of a batch, in order. Returns the
+// responses and the log entries of their calls, notifications are left out.
+func (m *Mux) dispatchBatch(batch []interface{}, codec Codec, r *http.Request) ([]R1, []*LogEntry) {
+    results := make([]R1, 0, len(batch))
+    calls := make([]*LogEntry, 0, len(batch))
+
+    for _, item := range batch {
+        start_time := time.Now()
+        result_map := New()
+
+        req, err := parseEnvelope(item)
+        AddId(result_map, req.Id)
+
+        if err != nil {
+            AddError(result_map, newErr(InvalidRequest, "standard-errors.InvalidRequest", langOf(r)))
+            results = append(results, result_map)
+            calls = append(calls, &LogEntry{Id: req.Id, Code: InvalidRequest, Elapsed: time.Since(start_time)})
+            continue
+        }
+
+        req.codec = codec
+        method := m.methodName(req.Method)
+
+        data, err_d := m.dispatch(req, withRequest(r, req, method))
+        if req.IsNotification() {
+            continue
+        }
+
+        if err_d != nil {
+            AddError(result_map, err_d)
+        } else {
+            AddResult(result_map, data)
+        }
+
+        results = append(results, result_map)
+        calls = append(calls, &LogEntry{Method: method, Id: req.Id, Code: codeOf(err_d), Elapsed: time.Since(start_time)})
+    }
+
+    return results, calls
+}
+
+// Invokes the handler of req. Returns either the result data or the error
+// object to answer with.
+func (m *Mux) dispatch(req *Request, r *http.Request) (interface{}, map[string]interface{}) {
+    fn := m.handler(req.Method)
+    if fn == nil {
+        return nil, newErr(MethodNotFound, "standard-errors.MethodNotFound", langOf(r))
+    }
+
+    stop := timingOf(r).Start(PhaseHandler)
+    data, err := fn(req, r)
+    stop()
+
+    if err != nil {
+        return nil, errorObject(err, langOf(r))
+    }
+
+    if data == nil {
+        return nil, newErr(InternalError, "standard-errors.InternalError", langOf(r))
+    }
+
+    return data, nil
+}
@@ -0,0 +1,238 @@
+package sdtp
+
+import (
+    "fmt"
+    "bytes"
+    "errors"
+    "reflect"
+    "strings"
+    "testing"
+    "net/http"
+    "net/http/httptest"
+)
+
+// Serves a JSON POST of body with h and returns the recorded response.
+func serveJson(h http.Handler, body string) *httptest.ResponseRecorder {
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, newJsonRequest(body))
+
+    return w
+}
+
+func TestMuxDispatch(t *testing.T) {
+    w := serveJson(newTestMux(), `{"id": 1, "method": "echo", "params": {"a": [1, "b"]}}`)
+
+    var response map[string]interface{}
+    decodeJson(t, w, &response)
+
+    want := map[string]interface{}{"a": []interface{}{float64(1), "b"}}
+    if response["id"] != float64(1) || !reflect.DeepEqual(response["result"], want) || response["error"] != nil {
+        t.Errorf("response = %v, want the params echoed", response)
+    }
+
+    if mediaTypeOf(w.Header().Get("Content-Type")) != "application/json" {
+        t.Errorf("Content-Type = %q", w.Header().Get("Content-Type"))
+    }
+}
+
+func TestMuxErrors(t *testing.T) {
+    m := newTestMux()
+
+    m.HandleFunc("plain", func(req *Request, r *http.Request) (interface{}, error) {
+        return nil, errors.New("database is down")
+    })
+
+    m.HandleFunc("wrapped", func(req *Request, r *http.Request) (interface{}, error) {
+        return nil, fmt.Errorf("loading: %w", NewConflict("taken"))
+    })
+
+    m.HandleFunc("nil", func(req *Request, r *http.Request) (interface{}, error) {
+        return nil, nil
+    })
+
+    tests := []struct {
+        method  string
+        code    int
+        message string
+    }{
+        {"nosuch", MethodNotFound, ""},
+        {"fail", NotFound, ""},
+        // Errors that are not SDTP errors are not disclosed
+        {"plain", InternalError, ""},
+        {"wrapped", Conflict, "taken"},
+        // A call without result has no response to send
+        {"nil", InternalError, ""},
+    }
+
+    for _, test := range tests {
+        var response map[string]interface{}
+        decodeJson(t, serveJson(m, `{"id": "x", "method": "` + test.method + `"}`), &response)
+
+        err_d, _ := response["error"].(map[string]interface{})
+        message, _ := err_d["message"].(string)
+
+        if response["id"] != "x" || responseCode(response) != test.code || response["result"] != nil {
+            t.Errorf("%s: response = %v, want code %d", test.method, response, test.code)
+        }
+
+        if message == "" || (test.message != "" && message != test.message) {
+            t.Errorf("%s: message = %q, want %q", test.method, message, test.message)
+        }
+    }
+}
+
+func TestMuxParamErrorData(t *testing.T) {
+    m := NewMux()
+
+    m.HandleFunc("params", func(req *Request, r *http.Request) (interface{}, error) {
+        return nil, NewSingleInvalidParams(Required, "param:name")
+    })
+
+    var response map[string]interface{}
+    decodeJson(t, serveJson(m, `{"id": 1, "method": "params"}`), &response)
+
+    err_d, _ := response["error"].(map[string]interface{})
+    data, _ := err_d["data"].([]interface{})
+
+    if len(data) != 1 {
+        t.Fatalf("error = %v, want a single parameter error", err_d)
+    }
+
+    // Parameter errors left without message are translated
+    entry, _ := data[0].(map[string]interface{})
+    if entry["code"] != float64(Required) || entry["location"] != "param:name" || entry["message"] == "" || entry["message"] == nil {
+        t.Errorf("entry = %v, want name required with a message", entry)
+    }
+}
+
+func TestMuxHandleFuncPanics(t *testing.T) {
+    fn := func(req *Request, r *http.Request) (interface{}, error) {
+        return "ok", nil
+    }
+
+    tests := []struct {
+        method string
+        fn     MethodFunc
+    }{
+        {"", fn},
+        {"echo", fn},
+        {"other", nil},
+    }
+
+    for _, test := range tests {
+        m := newTestMux()
+
+        func() {
+            defer func() {
+                if recover() == nil {
+                    t.Errorf("HandleFunc(%q) does not panic", test.method)
+                }
+            }()
+
+            m.HandleFunc(test.method, test.fn)
+        }()
+    }
+}
+
+func TestMuxBatch(t *testing.T) {
+    body := `[
+        {"id": 1, "method": "echo", "params": ["a"]},
+        {"id": 2},
+        {"method": "echo"},
+        "x",
+        {"id": "3", "method": "fail"},
+        {"id": 4, "method": "echo", "params": 1},
+        {"id": 5, "method": "nosuch"},
+        {"id": 6, "method": "echo", "params": ["b"]}
+    ]`
+
+    var responses []map[string]interface{}
+    decodeJson(t, serveJson(newTestMux(), body), &responses)
+
+    // Notifications are left out, every other call is answered in order
+    want := []struct {
+        id     interface{}
+        code   int
+        result interface{}
+    }{
+        {float64(1), 0, []interface{}{"a"}},
+        {float64(2), InvalidRequest, nil},
+        {nil, InvalidRequest, nil},
+        {"3", NotFound, nil},
+        {float64(4), InvalidRequest, nil},
+        {float64(5), MethodNotFound, nil},
+        {float64(6), 0, []interface{}{"b"}},
+    }
+
+    if len(responses) != len(want) {
+        t.Fatalf("responses = %v, want %d", responses, len(want))
+    }
+
+    for i, response := range responses {
+        if response["id"] != want[i].id || responseCode(response) != want[i].code || !reflect.DeepEqual(response["result"], want[i].result) {
+            t.Errorf("response %d = %v, want %+v", i, response, want[i])
+        }
+    }
+}
+
+func TestMuxEmptyBatch(t *testing.T) {
+    // Answered with a single response, there are no calls to answer
+    var response map[string]interface{}
+    if decodeJson(t, serveJson(newTestMux(), `[]`), &response); responseCode(response) != InvalidRequest || response["id"] != nil {
+        t.Errorf("response = %v, want InvalidRequest", response)
+    }
+}
+
+func TestMuxBatchCodec(t *testing.T) {
+    raw, _ := (MsgpackCodec{}).Marshal([]interface{}{
+        map[string]interface{}{"id": 1, "method": "echo", "params": map[string]interface{}{"a": "b"}},
+        map[string]interface{}{"id": 2, "method": "fail"},
+    })
+
+    r := httptest.NewRequest("POST", "/", bytes.NewReader(raw))
+    r.Header.Set("Content-Type", "application/msgpack")
+    r.Header.Set("Accept", "application/msgpack")
+
+    w := httptest.NewRecorder()
+    newTestMux().ServeHTTP(w, r)
+
+    var responses []map[string]interface{}
+    if err := (MsgpackCodec{}).Unmarshal(w.Body.Bytes(), &responses); err != nil {
+        t.Fatal(err)
+    }
+
+    if len(responses) != 2 || !reflect.DeepEqual(responses[0]["result"], map[string]interface{}{"a": "b"}) || responses[1]["error"] == nil {
+        t.Errorf("responses = %v, want the echo then the error", responses)
+    }
+}
+
+func TestMuxNotifications(t *testing.T) {
+    bodies := []string{
+        `{"method": "create"}`,
+        `{"method": "create", "params": {"a": 1}}`,
+        // Errors of notifications are not reported
+        `{"method": "nosuch"}`,
+        `[{"method": "create"}, {"method": "create"}, {"method": "nosuch"}]`,
+    }
+
+    for _, body := range bodies {
+        calls := 0
+        w := serveJson(newCountingMux(&calls), body)
+
+        if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+            t.Errorf("%s: status = %d, body = %q, want 204 without body", body, w.Code, w.Body.Bytes())
+        }
+
+        if calls != strings.Count(body, "create") {
+            t.Errorf("%s: calls = %d, want every notification dispatched", body, calls)
+        }
+    }
+
+    // A batch holding a call is answered with the call only
+    var responses []map[string]interface{}
+    decodeJson(t, serveJson(newTestMux(), `[{"method": "echo"}, {"id": 1, "method": "echo", "params": [1]}]`), &responses)
+
+    if len(responses) != 1 || responses[0]["id"] != float64(1) {
+        t.Errorf("responses = %v, want the call only", responses)
+    }
+}
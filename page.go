@@ -0,0 +1,192 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ *
+ * READ :: {"id": <ID>, "result": {"meta": <META>, "data": <DATA>, "pagination": <PAGINATION>}}
+ *
+ * Pagination:
+ *  offset :: {"offset": <OFFSET>, "limit": <LIMIT>, "total": <TOTAL>}
+ *  cursor :: {"limit": <LIMIT>, "next": <CURSOR>, "prev": <CURSOR>, "total": <TOTAL>}
+ *
+ * Params :: {"offset": <OFFSET>, "limit": <LIMIT>} or {"cursor": <CURSOR>, "limit": <LIMIT>}
+ */
+
+package sdtp
+
+import (
+    "time"
+    "reflect"
+    "net/http"
+    "encoding/json"
+)
+
+// Meta holds free form information about a READ result.
+type Meta map[string]interface{}
+
+// Pagination describes the position of a page in a READ result, either by
+// offset or by cursors.
+type Pagination struct {
+    Offset int
+    Limit  int
+
+    // Total number of items, -1 when unknown.
+    Total int
+
+    // Cursors of the next and previous pages, empty when there is none.
+    // Setting either of them makes the pagination cursor based.
+    Next string
+    Prev string
+}
+
+func NewOffsetPagination(offset int, limit int, total int) *Pagination {
+    return &Pagination{Offset: offset, Limit: limit, Total: total}
+}
+
+func NewCursorPagination(limit int, next string, prev string) *Pagination {
+    return &Pagination{Limit: limit, Total: -1, Next: next, Prev: prev}
+}
+
+// Returns true when the pagination is cursor based.
+func (p *Pagination) isCursor() bool {
+    return p.Next != "" || p.Prev != ""
+}
+
+// Builds the pagination object of a READ result.
+func (p *Pagination) toMap() map[string]interface{} {
+    pagination := map[string]interface{}{
+        "limit": p.Limit,
+    }
+
+    if p.isCursor() {
+        pagination["next"] = cursorOrNil(p.Next)
+        pagination["prev"] = cursorOrNil(p.Prev)
+    } else {
+        pagination["offset"] = p.Offset
+    }
+
+    if p.Total >= 0 {
+        pagination["total"] = p.Total
+    }
+
+    return pagination
+}
+
+func cursorOrNil(cursor string) interface{} {
+    if cursor == "" {
+        return nil
+    }
+
+    return cursor
+}
+
+// Builds the result of a READ call.
+func newPage(data interface{}, meta Meta, pagination *Pagination) map[string]interface{} {
+    if data == nil {
+        data = make([]interface{}, 0)
+    }
+
+    if meta == nil {
+        meta = Meta{}
+    }
+
+    var pagination_map map[string]interface{}
+    if pagination != nil {
+        pagination_map = pagination.toMap()
+    }
+
+    return map[string]interface{}{
+        "meta": meta,
+        "data": data,
+        "pagination": pagination_map,
+    }
+}
+
+// SendHttpPage sends the result of a READ call, a nil data is sent as an
+// empty list.
+func SendHttpPage(data interface{}, meta Meta, pagination *Pagination, start_time time.Time, w http.ResponseWriter, r *http.Request) {
+    SendHttpData(newPage(data, meta, pagination), start_time, w, r)
+}
+
+func SendWsPage(data interface{}, meta Meta, pagination *Pagination, start_time time.Time, c *WsConn, id interface{}) {
+    SendWsData(newPage(data, meta, pagination), start_time, c, id)
+}
+
+// PageParams are the pagination parameters of a READ call.
+type PageParams struct {
+    Offset int
+    Limit  int
+    Cursor string
+}
+
+// ReadPageParams reads "offset", "limit" and "cursor" from the params of req.
+// A missing limit is default_limit. Invalid values are reported as an
+// InvalidParams error, with one entry per parameter.
+func ReadPageParams(req *Request, default_limit int, max_limit int) (*PageParams, error) {
+    params, _ := req.Params.(map[string]interface{})
+
+    page := &PageParams{Limit: default_limit}
+    err_map := NewErrorData()
+
+    if v, ok := params["offset"]; ok && v != nil {
+        switch offset, ok := toInt(v); {
+            case !ok:
+                err_map = AddErrorData(err_map, paramEntry(Rejected, "param:offset"))
+            case offset < 0:
+                err_map = AddErrorData(err_map, paramEntry(TooLow, "param:offset"))
+            default:
+                page.Offset = offset
+        }
+    }
+
+    if v, ok := params["limit"]; ok && v != nil {
+        switch limit, ok := toInt(v); {
+            case !ok:
+                err_map = AddErrorData(err_map, paramEntry(Rejected, "param:limit"))
+            case limit < 1:
+                err_map = AddErrorData(err_map, paramEntry(TooLow, "param:limit"))
+            case max_limit > 0 && limit > max_limit:
+                err_map = AddErrorData(err_map, paramEntry(LimitExceeded, "param:limit"))
+            default:
+                page.Limit = limit
+        }
+    }
+
+    if v, ok := params["cursor"]; ok && v != nil {
+        cursor, ok := v.(string)
+
+        // A cursor already holds its position
+        if !ok || page.Offset != 0 {
+            err_map = AddErrorData(err_map, paramEntry(Rejected, "param:cursor"))
+        } else {
+            page.Cursor = cursor
+        }
+    }
+
+    if len(err_map) > 0 {
+        return nil, NewInvalidParams(err_map)
+    }
+
+    return page, nil
+}
+
+// Converts a decoded number to int. Floats are accepted when integral.
+func toInt(v interface{}) (int, bool) {
+    if n, ok := v.(json.Number); ok {
+        i, err := n.Int64()
+        return int(i), err == nil
+    }
+
+    rv := reflect.ValueOf(v)
+
+    switch rv.Kind() {
+        case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+            return int(rv.Int()), true
+        case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+            return int(rv.Uint()), true
+        case reflect.Float32, reflect.Float64:
+            f := rv.Float()
+            return int(f), f == float64(int(f))
+    }
+
+    return 0, false
+}
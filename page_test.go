@@ -0,0 +1,156 @@
+package sdtp
+
+import (
+    "time"
+    "errors"
+    "reflect"
+    "strconv"
+    "testing"
+    "net/http/httptest"
+)
+
+// Returns a request whose params are the JSON object params.
+func pageRequest(t *testing.T, params string) *Request {
+    t.Helper()
+
+    req, ok := ReadHttpRequest(time.Now(), httptest.NewRecorder(), newJsonRequest(`{"id": 1, "method": "list", "params": ` + params + `}`))
+    if !ok {
+        t.Fatalf("%s: not read", params)
+    }
+
+    return req
+}
+
+func TestReadPageParams(t *testing.T) {
+    tests := []struct {
+        params string
+        want   *PageParams
+    }{
+        {`{}`, &PageParams{Limit: 20}},
+        {`null`, &PageParams{Limit: 20}},
+        {`{"offset": null, "limit": null, "cursor": null}`, &PageParams{Limit: 20}},
+        {`{"offset": 40, "limit": 10}`, &PageParams{Offset: 40, Limit: 10}},
+        {`{"limit": 1}`, &PageParams{Limit: 1}},
+        {`{"limit": 100}`, &PageParams{Limit: 100}},
+        {`{"cursor": "abc", "limit": 5}`, &PageParams{Limit: 5, Cursor: "abc"}},
+        // A zero offset is no position
+        {`{"cursor": "abc", "offset": 0}`, &PageParams{Cursor: "abc", Limit: 20}},
+        // Unknown params are left to the method
+        {`{"sort": "name"}`, &PageParams{Limit: 20}},
+    }
+
+    for _, test := range tests {
+        page, err := ReadPageParams(pageRequest(t, test.params), 20, 100)
+
+        if err != nil || !reflect.DeepEqual(page, test.want) {
+            t.Errorf("%s: page = %+v, %v, want %+v", test.params, page, err, test.want)
+        }
+    }
+}
+
+func TestReadPageParamsErrors(t *testing.T) {
+    rejected := strconv.Itoa(Rejected)
+    too_low := strconv.Itoa(TooLow)
+    exceeded := strconv.Itoa(LimitExceeded)
+
+    tests := []struct {
+        params string
+        want   []string
+    }{
+        {`{"offset": -1}`, []string{"param:offset " + too_low}},
+        {`{"offset": "10"}`, []string{"param:offset " + rejected}},
+        {`{"offset": 2.5}`, []string{"param:offset " + rejected}},
+        {`{"limit": 0}`, []string{"param:limit " + too_low}},
+        {`{"limit": 101}`, []string{"param:limit " + exceeded}},
+        {`{"limit": 1.5}`, []string{"param:limit " + rejected}},
+        {`{"limit": true}`, []string{"param:limit " + rejected}},
+        {`{"cursor": 1}`, []string{"param:cursor " + rejected}},
+        // A cursor already holds its position
+        {`{"cursor": "abc", "offset": 10}`, []string{"param:cursor " + rejected}},
+        // One entry per parameter, in order
+        {`{"offset": -1, "limit": 0, "cursor": []}`, []string{"param:offset " + too_low, "param:limit " + too_low, "param:cursor " + rejected}},
+    }
+
+    for _, test := range tests {
+        page, err := ReadPageParams(pageRequest(t, test.params), 20, 100)
+
+        var e *Error
+        if !errors.As(err, &e) || e.Code != InvalidParams || page != nil {
+            t.Errorf("%s: page = %+v, err = %v, want InvalidParams", test.params, page, err)
+            continue
+        }
+
+        if entries := entriesOf(e.Data); !equalStrings(entries, test.want) {
+            t.Errorf("%s: entries = %v, want %v", test.params, entries, test.want)
+        }
+    }
+
+    // No max_limit
+    if page, err := ReadPageParams(pageRequest(t, `{"limit": 100000}`), 20, 0); err != nil || page.Limit != 100000 {
+        t.Errorf("page = %+v, %v, want the limit unbounded", page, err)
+    }
+}
+
+func TestToInt(t *testing.T) {
+    tests := []struct {
+        v    interface{}
+        want int
+        ok   bool
+    }{
+        {3, 3, true},
+        {int8(-3), -3, true},
+        {uint32(3), 3, true},
+        {float64(3), 3, true},
+        {float32(2.5), 2, false},
+        {"3", 0, false},
+        {nil, 0, false},
+    }
+
+    for _, test := range tests {
+        if n, ok := toInt(test.v); n != test.want || ok != test.ok {
+            t.Errorf("toInt(%#v) = %d, %v, want %d, %v", test.v, n, ok, test.want, test.ok)
+        }
+    }
+}
+
+func TestNewPage(t *testing.T) {
+    tests := []struct {
+        pagination *Pagination
+        want       map[string]interface{}
+    }{
+        {nil, nil},
+        {NewOffsetPagination(20, 10, 95), map[string]interface{}{"offset": 20, "limit": 10, "total": 95}},
+        // An unknown total is left out
+        {NewOffsetPagination(0, 10, -1), map[string]interface{}{"offset": 0, "limit": 10}},
+        {NewCursorPagination(10, "n", ""), map[string]interface{}{"limit": 10, "next": "n", "prev": nil}},
+        {NewCursorPagination(10, "", "p"), map[string]interface{}{"limit": 10, "next": nil, "prev": "p"}},
+        {&Pagination{Limit: 10, Total: 3, Next: "n", Prev: "p"}, map[string]interface{}{"limit": 10, "next": "n", "prev": "p", "total": 3}},
+        // Without cursors, a cursor pagination is the first and last page
+        {NewCursorPagination(10, "", ""), map[string]interface{}{"offset": 0, "limit": 10}},
+    }
+
+    for _, test := range tests {
+        page := newPage([]int{1}, Meta{"k": "v"}, test.pagination)
+
+        pagination, _ := page["pagination"].(map[string]interface{})
+        if !reflect.DeepEqual(pagination, test.want) {
+            t.Errorf("%+v: pagination = %v, want %v", test.pagination, pagination, test.want)
+        }
+    }
+
+    // Nil data and meta are sent empty
+    page := newPage(nil, nil, nil)
+    if data, ok := page["data"].([]interface{}); !ok || data == nil || len(data) != 0 || !reflect.DeepEqual(page["meta"], Meta{}) {
+        t.Errorf("page = %#v, want empty data and meta", page)
+    }
+}
+
+func TestSendHttpPage(t *testing.T) {
+    w := httptest.NewRecorder()
+    SendHttpPage(nil, nil, NewCursorPagination(10, "n", ""), time.Now(), w, WithRequestId(newJsonRequest(""), 1))
+
+    want := `{"id":1,"result":{"data":[],"meta":{},"pagination":{"limit":10,"next":"n","prev":null}}}`
+    if w.Body.String() != want {
+        t.Errorf("body = %s, want %s", w.Body.String(), want)
+    }
+}
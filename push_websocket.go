@@ -0,0 +1,224 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ *
+ * Push :: {"method": <TOPIC>, "params": <PAYLOAD>}, encoded with the codec of each connection
+ */
+
+package sdtp
+
+import (
+    "sync"
+    "net/http"
+    "sync/atomic"
+)
+
+// Methods registered by Hub.HandleSubscriptions, both take {"topic": <TOPIC>}.
+const (
+    SubscribeMethod   = "subscribe"
+    UnsubscribeMethod = "unsubscribe"
+)
+
+// Push sends an event to a single connection. Events carry no id and are
+// not answered by the client.
+func Push(c *WsConn, method string, params interface{}) error {
+    _, err := c.write(newEvent(method, params))
+
+    return err
+}
+
+// Builds the envelope of a server initiated event.
+func newEvent(method string, params interface{}) R1 {
+    event := New()
+    event["method"] = method
+    event["params"] = params
+
+    return event
+}
+
+// Hub keeps track of the open WebSocket connections and of their topic
+// subscriptions.
+type Hub struct {
+    mu     sync.RWMutex
+    conns  map[*WsConn]map[string]bool
+    topics map[string]map[*WsConn]bool
+}
+
+func NewHub() *Hub {
+    return &Hub{
+        conns:  make(map[*WsConn]map[string]bool),
+        topics: make(map[string]map[*WsConn]bool),
+    }
+}
+
+// Register adds a connection to the hub. WsHandler does it for every
+// connection when its Hub is set.
+func (h *Hub) Register(c *WsConn) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    if _, ok := h.conns[c]; !ok {
+        h.conns[c] = make(map[string]bool)
+    }
+}
+
+// Unregister removes a connection and all its subscriptions.
+func (h *Hub) Unregister(c *WsConn) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    for topic := range h.conns[c] {
+        h.removeLocked(c, topic)
+    }
+
+    delete(h.conns, c)
+}
+
+// Subscribe adds the connection to the subscribers of topic.
+func (h *Hub) Subscribe(c *WsConn, topic string) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    if _, ok := h.conns[c]; !ok {
+        h.conns[c] = make(map[string]bool)
+    }
+
+    if _, ok := h.topics[topic]; !ok {
+        h.topics[topic] = make(map[*WsConn]bool)
+    }
+
+    h.conns[c][topic] = true
+    h.topics[topic][c] = true
+}
+
+// Unsubscribe removes the connection from the subscribers of topic.
+func (h *Hub) Unsubscribe(c *WsConn, topic string) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    h.removeLocked(c, topic)
+}
+
+func (h *Hub) removeLocked(c *WsConn, topic string) {
+    delete(h.conns[c], topic)
+    delete(h.topics[topic], c)
+
+    if len(h.topics[topic]) == 0 {
+        delete(h.topics, topic)
+    }
+}
+
+// Publish pushes {"method": topic, "params": payload} to every subscriber of
+// topic, each in the encoding negotiated by its connection. Returns the
+// number of connections the event was delivered to.
+func (h *Hub) Publish(topic string, payload interface{}) int {
+    h.mu.RLock()
+    conns := make([]*WsConn, 0, len(h.topics[topic]))
+    for c := range h.topics[topic] {
+        conns = append(conns, c)
+    }
+    h.mu.RUnlock()
+
+    return h.push(conns, newEvent(topic, payload))
+}
+
+// Broadcast pushes an event to every registered connection.
+func (h *Hub) Broadcast(method string, params interface{}) int {
+    h.mu.RLock()
+    conns := make([]*WsConn, 0, len(h.conns))
+    for c := range h.conns {
+        conns = append(conns, c)
+    }
+    h.mu.RUnlock()
+
+    return h.push(conns, newEvent(method, params))
+}
+
+// Writes the event to the connections, encoding it once per codec. Every
+// connection is written to by its own goroutine, so that a slow peer only
+// delays itself, and push returns once all writes are done. A connection that
+// cannot be written to is closed, its read loop then unregisters it.
+func (h *Hub) push(conns []*WsConn, event R1) int {
+    encoded := make(map[string][]byte, 2)
+
+    var wg sync.WaitGroup
+    var delivered int64
+
+    for _, c := range conns {
+        content_type := c.codec.ContentType()
+
+        raw, ok := encoded[content_type]
+        if !ok {
+            var err error
+            if raw, err = c.codec.Marshal(event); err != nil {
+                continue
+            }
+            encoded[content_type] = raw
+        }
+
+        wg.Add(1)
+        go func(c *WsConn, raw []byte) {
+            defer wg.Done()
+
+            if err := c.writeRaw(raw); err != nil {
+                c.Close()
+                return
+            }
+
+            atomic.AddInt64(&delivered, 1)
+        }(c, raw)
+    }
+
+    wg.Wait()
+
+    return int(delivered)
+}
+
+// HandleSubscriptions registers the subscribe and unsubscribe methods on the
+// Mux, letting WebSocket clients manage their own subscriptions.
+func (h *Hub) HandleSubscriptions(m *Mux) {
+    m.HandleFunc(SubscribeMethod, func(req *Request, r *http.Request) (interface{}, error) {
+        c, topic, err := subscriptionOf(req, r)
+        if err != nil {
+            return nil, err
+        }
+
+        h.Subscribe(c, topic)
+
+        return true, nil
+    })
+
+    m.HandleFunc(UnsubscribeMethod, func(req *Request, r *http.Request) (interface{}, error) {
+        c, topic, err := subscriptionOf(req, r)
+        if err != nil {
+            return nil, err
+        }
+
+        h.Unsubscribe(c, topic)
+
+        return true, nil
+    })
+}
+
+// Returns the connection and the topic of a (un)subscribe request.
+func subscriptionOf(req *Request, r *http.Request) (*WsConn, string, error) {
+    // Subscriptions are only available over WebSocket
+    c := WsConnFromRequest(r)
+    if c == nil {
+        return nil, "", ErrMethodNotFound
+    }
+
+    var params struct {
+        Topic string `json:"topic"`
+    }
+
+    if err := req.BindParams(&params); err != nil {
+        return nil, "", err
+    }
+
+    if params.Topic == "" {
+        return nil, "", NewSingleInvalidParams(Required, "param:topic")
+    }
+
+    return c, params.Topic, nil
+}
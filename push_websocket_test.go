@@ -0,0 +1,191 @@
+package sdtp
+
+import (
+    "time"
+    "testing"
+
+    "github.com/gorilla/websocket"
+)
+
+// Returns a handler whose connections are registered to hub and manage their
+// subscriptions.
+func newHubHandler(hub *Hub) *WsHandler {
+    m := newTestMux()
+    hub.HandleSubscriptions(m)
+
+    h := NewWsHandler(m)
+    h.Hub = hub
+
+    return h
+}
+
+// Calls method with the topic and checks it succeeded.
+func subscribeWs(t *testing.T, conn *websocket.Conn, method string, topic string) {
+    t.Helper()
+
+    writeWs(t, conn, `{"id": "s", "method": "` + method + `", "params": {"topic": "` + topic + `"}}`)
+
+    var response map[string]interface{}
+    if readWs(t, conn, &response); response["result"] != true {
+        t.Fatalf("%s %s: response = %v", method, topic, response)
+    }
+}
+
+// Returns the connections subscribed to topic.
+func subscribersOf(hub *Hub, topic string) []*WsConn {
+    hub.mu.RLock()
+    defer hub.mu.RUnlock()
+
+    conns := make([]*WsConn, 0, len(hub.topics[topic]))
+    for c := range hub.topics[topic] {
+        conns = append(conns, c)
+    }
+
+    return conns
+}
+
+func TestHubSubscriptions(t *testing.T) {
+    hub := NewHub()
+    a, b := &WsConn{}, &WsConn{}
+
+    hub.Register(a)
+    hub.Subscribe(a, "news")
+    hub.Subscribe(a, "sports")
+    hub.Subscribe(b, "news")
+
+    if n := len(subscribersOf(hub, "news")); n != 2 {
+        t.Errorf("news subscribers = %d, want 2", n)
+    }
+
+    hub.Unsubscribe(b, "news")
+    hub.Unsubscribe(b, "nosuch")
+
+    if conns := subscribersOf(hub, "news"); len(conns) != 1 || conns[0] != a {
+        t.Errorf("news subscribers = %v, want a only", conns)
+    }
+
+    hub.Unregister(a)
+
+    // Topics left without subscribers are dropped
+    if len(hub.topics) != 0 || len(hub.conns) != 1 {
+        t.Errorf("topics = %v, conns = %v, want b only", hub.topics, hub.conns)
+    }
+}
+
+func TestHubPublish(t *testing.T) {
+    hub := NewHub()
+    h := newHubHandler(hub)
+
+    news, other := dialWs(t, h), dialWs(t, h)
+
+    subscribeWs(t, news, SubscribeMethod, "news")
+    subscribeWs(t, other, SubscribeMethod, "other")
+
+    if n := hub.Publish("news", map[string]interface{}{"title": "x"}); n != 1 {
+        t.Errorf("Publish = %d, want 1", n)
+    }
+
+    var event map[string]interface{}
+    readWs(t, news, &event)
+
+    if event["method"] != "news" || event["params"].(map[string]interface{})["title"] != "x" {
+        t.Errorf("event = %v", event)
+    }
+
+    if _, ok := event["id"]; ok {
+        t.Errorf("event = %v, want no id", event)
+    }
+
+    if n := hub.Broadcast("ping", nil); n != 2 {
+        t.Errorf("Broadcast = %d, want 2", n)
+    }
+
+    for _, conn := range []*websocket.Conn{news, other} {
+        if readWs(t, conn, &event); event["method"] != "ping" {
+            t.Errorf("event = %v, want ping", event)
+        }
+    }
+
+    subscribeWs(t, news, UnsubscribeMethod, "news")
+
+    if n := hub.Publish("news", "y"); n != 0 {
+        t.Errorf("Publish after unsubscribe = %d, want 0", n)
+    }
+}
+
+func TestHubUnregistersClosedConnections(t *testing.T) {
+    hub := NewHub()
+    conn := dialWs(t, newHubHandler(hub))
+
+    subscribeWs(t, conn, SubscribeMethod, "news")
+    conn.Close()
+
+    deadline := time.Now().Add(5 * time.Second)
+    for len(subscribersOf(hub, "news")) > 0 {
+        if time.Now().After(deadline) {
+            t.Fatal("closed connection still subscribed")
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+func TestHubPublishToSlowConnection(t *testing.T) {
+    hub := NewHub()
+    h := newHubHandler(hub)
+
+    slow, fast := dialWs(t, h), dialWs(t, h)
+
+    subscribeWs(t, slow, SubscribeMethod, "slow")
+    subscribeWs(t, slow, SubscribeMethod, "news")
+    subscribeWs(t, fast, SubscribeMethod, "news")
+
+    // Writes to the slow connection wait while its lock is held
+    slow_c := subscribersOf(hub, "slow")[0]
+    slow_c.mu.Lock()
+
+    done := make(chan int)
+    go func() {
+        done <- hub.Publish("news", "x")
+    }()
+
+    var event map[string]interface{}
+    if readWs(t, fast, &event); event["params"] != "x" {
+        t.Errorf("event = %v", event)
+    }
+
+    select {
+        case <-done:
+            t.Error("Publish returned before writing to the slow connection")
+        default:
+    }
+
+    slow_c.mu.Unlock()
+
+    if n := <-done; n != 2 {
+        t.Errorf("Publish = %d, want 2", n)
+    }
+
+    if readWs(t, slow, &event); event["params"] != "x" {
+        t.Errorf("event = %v", event)
+    }
+}
+
+func TestSubscribeErrors(t *testing.T) {
+    hub := NewHub()
+    conn := dialWs(t, newHubHandler(hub))
+
+    var response map[string]interface{}
+
+    writeWs(t, conn, `{"id": 1, "method": "subscribe", "params": {}}`)
+    if readWs(t, conn, &response); responseCode(response) != InvalidParams {
+        t.Errorf("response = %v, want InvalidParams", response)
+    }
+
+    // Subscriptions need a WebSocket connection
+    m := NewMux()
+    hub.HandleSubscriptions(m)
+
+    if decodeJson(t, serveJson(m, `{"id": 1, "method": "subscribe", "params": {"topic": "news"}}`), &response); responseCode(response) != MethodNotFound {
+        t.Errorf("response = %v, want MethodNotFound", response)
+    }
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ *
+ * Request:
+ *  Content-type :: any registered codec, "application/msgpack" (default)
+ *  Body :: {"id": <ID>, "method": <METHOD>, "params": <PARAMS>}
+ */
+
+package sdtp
+
+import (
+    "io"
+    "errors"
+    "context"
+    "time"
+    "reflect"
+    "net/http"
+    "encoding/json"
+)
+
+// Request is the decoded envelope of an incoming call.
+type Request struct {
+    Id     interface{}
+    Method string
+    Params interface{}
+
+    codec        Codec
+    notification bool
+}
+
+// Header used to correlate requests that are not decoded by ReadHttpRequest.
+const RequestIdHeader = "X-Request-Id"
+
+type contextKey int
+
+const (
+    requestIdKey contextKey = iota
+    wsConnKey
+    httpRequestKey
+    methodKey
+    configKey
+    timingKey
+)
+
+// WithRequestId returns a shallow copy of r carrying the request id, which is
+// echoed back by every SendHttp* function.
+func WithRequestId(r *http.Request, id interface{}) *http.Request {
+    return r.WithContext(context.WithValue(r.Context(), requestIdKey, id))
+}
+
+// Returns a shallow copy of r carrying the id of req and method, the name
+// logged for it.
+func withRequest(r *http.Request, req *Request, method string) *http.Request {
+    ctx := context.WithValue(r.Context(), requestIdKey, req.Id)
+    ctx = context.WithValue(ctx, methodKey, method)
+
+    return r.WithContext(ctx)
+}
+
+// Returns the method of the call r answers, or "" when unknown.
+func methodOf(r *http.Request) string {
+    method, _ := r.Context().Value(methodKey).(string)
+
+    return method
+}
+
+// RequestId returns the id set by WithRequestId, falling back to the
+// X-Request-Id header. It returns nil when the request has no id.
+func RequestId(r *http.Request) interface{} {
+    if id := r.Context().Value(requestIdKey); id != nil {
+        return id
+    }
+
+    if id := r.Header.Get(RequestIdHeader); id != "" {
+        return id
+    }
+
+    return nil
+}
+
+// IsNotification reports whether the request was sent without an id, in which
+// case the client expects no response body.
+func (req *Request) IsNotification() bool {
+    return req.notification
+}
+
+// BindParams decodes the request params into v, using the same encoding the
+// request was received with. Params that do not fit v are reported as an
+// InvalidParams error.
+func (req *Request) BindParams(v interface{}) error {
+    if err := req.bindParams(v); err != nil {
+        return wrapError(InvalidParams, err)
+    }
+
+    return nil
+}
+
+func (req *Request) bindParams(v interface{}) error {
+    raw, err := req.codec.Marshal(req.Params)
+    if err != nil {
+        return err
+    }
+
+    return req.codec.Unmarshal(raw, v)
+}
+
+// ReadHttpRequest decodes the SDTP envelope from the request body. When the
+// body is malformed, or the client accepts none of the codecs for a call
+// expecting a response, the matching error is sent and false is returned, so
+// the caller only has to return.
+//
+// The request id is not attached to r, callers answering with the SendHttp*
+// functions should use WithRequestId(r, req.Id). Notifications should be
+// answered with SendHttpNoContent.
+func ReadHttpRequest(start_time time.Time, w http.ResponseWriter, r *http.Request) (*Request, bool) {
+    body, codec, err := decodeHttpBody(r)
+    if err != nil {
+        sendHttpDecodeError(err, start_time, w, r)
+        return nil, false
+    }
+
+    req, err := parseEnvelope(body)
+    if err != nil {
+        SendHttpInvalidRequest(start_time, w, withRequest(r, req, ""))
+        return nil, false
+    }
+
+    req.codec = codec
+
+    if !req.IsNotification() && !acceptHttp(start_time, w, withRequest(r, req, "")) {
+        return nil, false
+    }
+
+    return req, true
+}
+
+// Returns the codec of the Content-Type of r. Unknown or missing types are
+// decoded with the default codec.
+func requestCodec(r *http.Request) Codec {
+    if c := CodecFor(r.Header.Get("Content-Type")); c != nil {
+        return c
+    }
+
+    return defaultCodec()
+}
+
+// Decodes the raw request body into generic values. Bodies larger than the
+// MaxBodySize of the Config are not read past the limit.
+func decodeHttpBody(r *http.Request) (interface{}, Codec, error) {
+    defer timingOf(r).Start(PhaseDecode)()
+
+    codec := requestCodec(r)
+
+    body := r.Body
+    if limit := configOf(r).maxBodySize(); limit > 0 {
+        body = http.MaxBytesReader(nil, r.Body, limit)
+    }
+
+    raw, err := io.ReadAll(body)
+    if err != nil {
+        return nil, codec, err
+    }
+
+    decoded, err := decodeBody(raw, codec)
+
+    return decoded, codec, err
+}
+
+// Answers a body decodeHttpBody failed on, with InvalidRequest when it is
+// too large and ParseError otherwise.
+func sendHttpDecodeError(err error, start_time time.Time, w http.ResponseWriter, r *http.Request) {
+    var too_large *http.MaxBytesError
+    if errors.As(err, &too_large) {
+        SendHttpInvalidRequest(start_time, w, r)
+        return
+    }
+
+    SendHttpParseError(start_time, w, r)
+}
+
+// Decodes a raw message into generic values.
+func decodeBody(raw []byte, codec Codec) (interface{}, error) {
+    var body interface{}
+
+    if err := codec.Unmarshal(raw, &body); err != nil {
+        return nil, err
+    }
+
+    return body, nil
+}
+
+// Validates the shape of a decoded envelope. The returned request is never
+// nil, on error it still holds the id when one could be read.
+func parseEnvelope(body interface{}) (*Request, error) {
+    req := &Request{}
+
+    envelope, ok := body.(map[string]interface{})
+    if !ok {
+        return req, ErrInvalidRequest
+    }
+
+    if id, ok := envelope["id"]; ok {
+        if req.Id, ok = normalizeId(id); !ok {
+            return req, ErrInvalidRequest
+        }
+    } else {
+        req.notification = true
+    }
+
+    if req.Method, ok = envelope["method"].(string); !ok || req.Method == "" {
+        return req, ErrInvalidRequest
+    }
+
+    switch params := envelope["params"].(type) {
+        case nil, map[string]interface{}, []interface{}:
+            req.Params = params
+        default:
+            return req, ErrInvalidRequest
+    }
+
+    return req, nil
+}
+
+// Converts a decoded id to string, int64 or float64. Any other type is not a
+// valid id.
+func normalizeId(id interface{}) (interface{}, bool) {
+    switch v := id.(type) {
+        case nil, string:
+            return v, true
+        case json.Number:
+            if n, err := v.Int64(); err == nil {
+                return n, true
+            }
+            if f, err := v.Float64(); err == nil {
+                return f, true
+            }
+            return nil, false
+    }
+
+    v := reflect.ValueOf(id)
+
+    switch v.Kind() {
+        case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+            return v.Int(), true
+        case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+            return int64(v.Uint()), true
+        case reflect.Float32, reflect.Float64:
+            return v.Float(), true
+    }
+
+    return nil, false
+}
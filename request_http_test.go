@@ -0,0 +1,266 @@
+package sdtp
+
+import (
+    "time"
+    "bytes"
+    "reflect"
+    "strings"
+    "testing"
+    "net/http"
+    "encoding/json"
+    "net/http/httptest"
+)
+
+// Returns a POST of body, accepting JSON.
+func newJsonRequest(body string) *http.Request {
+    r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+    r.Header.Set("Content-Type", "application/json")
+    r.Header.Set("Accept", "application/json")
+
+    return r
+}
+
+// Decodes the JSON body of a recorded response into v.
+func decodeJson(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+    t.Helper()
+
+    if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+        t.Fatalf("%v: %q", err, w.Body.Bytes())
+    }
+}
+
+func TestReadHttpRequest(t *testing.T) {
+    tests := []struct {
+        body         string
+        id           interface{}
+        params       interface{}
+        notification bool
+    }{
+        {`{"id": 1, "method": "m", "params": {"a": 1}}`, int64(1), map[string]interface{}{"a": json.Number("1")}, false},
+        {`{"id": "x", "method": "m", "params": ["a"]}`, "x", []interface{}{"a"}, false},
+        {`{"id": 1.5, "method": "m"}`, 1.5, nil, false},
+        // A null id still expects a response
+        {`{"id": null, "method": "m", "params": null}`, nil, nil, false},
+        {`{"method": "m"}`, nil, nil, true},
+    }
+
+    for _, test := range tests {
+        req, ok := ReadHttpRequest(time.Now(), httptest.NewRecorder(), newJsonRequest(test.body))
+        if !ok {
+            t.Errorf("%s: not read", test.body)
+            continue
+        }
+
+        if req.Id != test.id || req.Method != "m" || !reflect.DeepEqual(req.Params, test.params) || req.IsNotification() != test.notification {
+            t.Errorf("%s: request = %+v, notification = %v", test.body, req, req.IsNotification())
+        }
+    }
+}
+
+func TestReadHttpRequestMsgpack(t *testing.T) {
+    raw, err := (MsgpackCodec{}).Marshal(map[string]interface{}{"id": 7, "method": "m", "params": map[string]interface{}{"a": "b"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // msgpack is the default when the body has no Content-Type
+    for _, content_type := range []string{"application/msgpack", ""} {
+        r := httptest.NewRequest("POST", "/", bytes.NewReader(raw))
+        r.Header.Set("Content-Type", content_type)
+
+        req, ok := ReadHttpRequest(time.Now(), httptest.NewRecorder(), r)
+        if !ok {
+            t.Fatalf("%q: not read", content_type)
+        }
+
+        if req.Id != int64(7) || req.Method != "m" {
+            t.Errorf("%q: request = %+v", content_type, req)
+        }
+
+        var params struct {
+            A string `msgpack:"a"`
+        }
+        if err := req.BindParams(&params); err != nil || params.A != "b" {
+            t.Errorf("%q: BindParams = %+v, %v", content_type, params, err)
+        }
+    }
+
+    // 0xc1 is never used by msgpack
+    r := httptest.NewRequest("POST", "/", strings.NewReader("\xc1"))
+    r.Header.Set("Content-Type", "application/msgpack")
+    r.Header.Set("Accept", "application/json")
+
+    w := httptest.NewRecorder()
+    if _, ok := ReadHttpRequest(time.Now(), w, r); ok {
+        t.Fatal("malformed msgpack body read")
+    }
+
+    var response map[string]interface{}
+    if decodeJson(t, w, &response); responseCode(response) != ParseError {
+        t.Errorf("response = %v, want ParseError", response)
+    }
+}
+
+func TestReadHttpRequestErrors(t *testing.T) {
+    tests := []struct {
+        body string
+        code int
+        id   interface{}
+    }{
+        {`{"id": 1,`, ParseError, nil},
+        {`{"id": 1, "method": "m"} x`, ParseError, nil},
+        {`"m"`, InvalidRequest, nil},
+        {`[{"id": 1, "method": "m"}]`, InvalidRequest, nil},
+        {`{"id": 1}`, InvalidRequest, float64(1)},
+        {`{"id": 1, "method": ""}`, InvalidRequest, float64(1)},
+        {`{"id": 1, "method": 2}`, InvalidRequest, float64(1)},
+        {`{"id": true, "method": "m"}`, InvalidRequest, nil},
+        {`{"id": {"a": 1}, "method": "m"}`, InvalidRequest, nil},
+        {`{"id": "a", "method": "m", "params": 1}`, InvalidRequest, "a"},
+        {`{"id": "a", "method": "m", "params": "x"}`, InvalidRequest, "a"},
+    }
+
+    for _, test := range tests {
+        w := httptest.NewRecorder()
+
+        if req, ok := ReadHttpRequest(time.Now(), w, newJsonRequest(test.body)); ok || req != nil {
+            t.Errorf("%s: read as %+v", test.body, req)
+            continue
+        }
+
+        var response map[string]interface{}
+        decodeJson(t, w, &response)
+
+        if responseCode(response) != test.code || response["id"] != test.id {
+            t.Errorf("%s: response = %v, want code %d and id %v", test.body, response, test.code, test.id)
+        }
+    }
+}
+
+func TestReadHttpRequestMaxBodySize(t *testing.T) {
+    body := `{"id": 1, "method": "m", "params": ["` + strings.Repeat("a", 64) + `"]}`
+
+    tests := []struct {
+        max_size int64
+        ok       bool
+    }{
+        {int64(len(body)), true},
+        {int64(len(body)) - 1, false},
+        // Disabled
+        {-1, true},
+    }
+
+    for _, test := range tests {
+        w := httptest.NewRecorder()
+        r := WithConfig(newJsonRequest(body), &Config{MaxBodySize: test.max_size})
+
+        if _, ok := ReadHttpRequest(time.Now(), w, r); ok != test.ok {
+            t.Errorf("%d: ok = %v, want %v", test.max_size, ok, test.ok)
+            continue
+        }
+
+        if test.ok {
+            continue
+        }
+
+        // Too large bodies are not malformed
+        var response map[string]interface{}
+        if decodeJson(t, w, &response); responseCode(response) != InvalidRequest {
+            t.Errorf("%d: response = %v, want InvalidRequest", test.max_size, response)
+        }
+    }
+
+    if size := (&Config{}).maxBodySize(); size != DefaultMaxBodySize {
+        t.Errorf("default size = %d, want %d", size, DefaultMaxBodySize)
+    }
+}
+
+func TestNormalizeId(t *testing.T) {
+    tests := []struct {
+        id   interface{}
+        want interface{}
+        ok   bool
+    }{
+        {nil, nil, true},
+        {"a", "a", true},
+        {json.Number("3"), int64(3), true},
+        {json.Number("-1.5"), -1.5, true},
+        {json.Number("1e400"), nil, false},
+        {int8(3), int64(3), true},
+        {uint16(4), int64(4), true},
+        {float32(1.5), 1.5, true},
+        {true, nil, false},
+        {[]interface{}{1}, nil, false},
+        {map[string]interface{}{}, nil, false},
+    }
+
+    for _, test := range tests {
+        if id, ok := normalizeId(test.id); id != test.want || ok != test.ok {
+            t.Errorf("normalizeId(%#v) = %#v, %v, want %#v, %v", test.id, id, ok, test.want, test.ok)
+        }
+    }
+}
+
+func TestRequestId(t *testing.T) {
+    r := httptest.NewRequest("POST", "/", nil)
+
+    if id := RequestId(r); id != nil {
+        t.Errorf("RequestId = %v, want nil", id)
+    }
+
+    r.Header.Set(RequestIdHeader, "header-id")
+    if id := RequestId(r); id != "header-id" {
+        t.Errorf("RequestId = %v, want the header", id)
+    }
+
+    // The id of the envelope wins over the header
+    for _, id := range []interface{}{"a", int64(7), 1.5} {
+        if got := RequestId(WithRequestId(r, id)); got != id {
+            t.Errorf("RequestId = %#v, want %#v", got, id)
+        }
+    }
+}
+
+func TestRequestIdEchoed(t *testing.T) {
+    tests := []struct {
+        id   interface{}
+        want interface{}
+    }{
+        {"a", "a"},
+        {int64(7), float64(7)},
+        {-2.5, -2.5},
+    }
+
+    for _, test := range tests {
+        w := httptest.NewRecorder()
+        SendHttpData("ok", time.Now(), w, WithRequestId(newJsonRequest(""), test.id))
+
+        var response map[string]interface{}
+        if decodeJson(t, w, &response); response["id"] != test.want || response["result"] != "ok" {
+            t.Errorf("%#v: response = %v", test.id, response)
+        }
+    }
+
+    // Handlers answering without an envelope still correlate their responses
+    r := newJsonRequest("")
+    r.Header.Set(RequestIdHeader, "header-id")
+
+    w := httptest.NewRecorder()
+    SendHttpNotFound(time.Now(), w, r)
+
+    var response map[string]interface{}
+    if decodeJson(t, w, &response); response["id"] != "header-id" || responseCode(response) != NotFound {
+        t.Errorf("response = %v, want the header id", response)
+    }
+}
+
+func TestMuxEchoesId(t *testing.T) {
+    for _, body := range []string{`{"id": "a", "method": "echo"}`, `{"id": 7, "method": "fail"}`, `{"id": 7, "method": "nosuch"}`} {
+        var request, response map[string]interface{}
+        json.Unmarshal([]byte(body), &request)
+
+        if decodeJson(t, serveJson(newTestMux(), body), &response); response["id"] != request["id"] {
+            t.Errorf("%s: response = %v, want the id echoed", body, response)
+        }
+    }
+}
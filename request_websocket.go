@@ -0,0 +1,291 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ *
+ * Request:
+ *  Sec-WebSocket-Protocol :: "sdtp.<subtype>" of a registered codec, e.g. "sdtp.json", "sdtp.msgpack" (default)
+ *  Accept :: media types of the registered codecs, when no subprotocol is negotiated
+ *  Message :: {"id": <ID>, "method": <METHOD>, "params": <PARAMS>}
+ */
+
+package sdtp
+
+import (
+    "time"
+    "sync"
+    "context"
+    "net/http"
+
+    "github.com/gorilla/websocket"
+)
+
+// Subprotocols selecting the encoding of a WebSocket connection. Every
+// registered codec is selected by "sdtp." followed by its media subtype.
+const (
+    WsProtocolJson    = "sdtp.json"
+    WsProtocolMsgpack = "sdtp.msgpack"
+)
+
+// Time allowed to write a message to the peer.
+const wsWriteWait = 10 * time.Second
+
+// Number of requests of a connection handled at once when the WsHandler sets
+// no MaxInFlight.
+const DefaultWsMaxInFlight = 16
+
+// WsConn is a WebSocket connection speaking SDTP. Its codec is fixed when
+// the connection is upgraded.
+type WsConn struct {
+    conn  *websocket.Conn
+    r     *http.Request
+    codec Codec
+
+    mu sync.Mutex
+}
+
+// Request returns the upgrade request of the connection.
+func (c *WsConn) Request() *http.Request {
+    return c.r
+}
+
+// Close closes the underlying connection.
+func (c *WsConn) Close() error {
+    return c.conn.Close()
+}
+
+// Encodes v with the codec of the connection and writes it. Returns the
+// number of bytes written.
+func (c *WsConn) write(v interface{}) (int, error) {
+    raw, err := c.codec.Marshal(v)
+    if err != nil {
+        return 0, err
+    }
+
+    if err := c.writeRaw(raw); err != nil {
+        return 0, err
+    }
+
+    return len(raw), nil
+}
+
+// Writes v and observes the response described by e. Nothing is observed
+// when the write fails.
+func (c *WsConn) send(v interface{}, start_time time.Time, e *LogEntry) error {
+    size, err := c.write(v)
+    if err != nil {
+        return err
+    }
+
+    e.Size = size
+    c.observeResponse(start_time, e)
+
+    return nil
+}
+
+// Logs and observes a response sent on the connection. The SendWs*
+// functions do not know the method of the call and leave it empty, the calls
+// answered by a WsHandler carry theirs.
+func (c *WsConn) observeResponse(start_time time.Time, e *LogEntry) {
+    e.Encoding = mediaTypeOf(c.codec.ContentType())
+
+    observeResponse(c.r, start_time, e)
+}
+
+// Writes an already encoded message, as a text message for textual codecs
+// and a binary message otherwise.
+func (c *WsConn) writeRaw(raw []byte) error {
+    message_type := websocket.BinaryMessage
+    if isTextCodec(c.codec) {
+        message_type = websocket.TextMessage
+    }
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+
+    return c.conn.WriteMessage(message_type, raw)
+}
+
+// WsConnFromRequest returns the connection a request was received on, or nil
+// when it did not come from a WebSocket.
+func WsConnFromRequest(r *http.Request) *WsConn {
+    c, _ := r.Context().Value(wsConnKey).(*WsConn)
+
+    return c
+}
+
+// WsHandler upgrades HTTP connections to WebSocket and dispatches every SDTP
+// request read from them to the Mux. Requests of a connection are handled
+// concurrently, responses are correlated by their id. When Hub is set every
+// connection is registered to it while open.
+//
+// Messages are limited to the MaxBodySize of the Config of the upgrade
+// request.
+type WsHandler struct {
+    Mux      *Mux
+    Hub      *Hub
+    Upgrader websocket.Upgrader
+
+    // MaxInFlight bounds the requests of a connection handled at once, 0
+    // uses DefaultWsMaxInFlight. Reading waits while the bound is reached.
+    MaxInFlight int
+}
+
+// NewWsHandler returns a handler offering a subprotocol for each codec
+// registered so far.
+func NewWsHandler(m *Mux) *WsHandler {
+    media_types := codecMediaTypes()
+    subprotocols := make([]string, len(media_types))
+
+    for i, media_type := range media_types {
+        subprotocols[i] = wsProtocolOf(media_type)
+    }
+
+    return &WsHandler{
+        Mux: m,
+        Upgrader: websocket.Upgrader{
+            Subprotocols: subprotocols,
+        },
+    }
+}
+
+// Returns the subprotocol selecting the codec of media_type.
+func wsProtocolOf(media_type string) string {
+    return "sdtp." + encodingName(media_type)
+}
+
+// Returns the codec selected by a subprotocol, or nil.
+func wsCodecOf(subprotocol string) Codec {
+    for _, media_type := range codecMediaTypes() {
+        if wsProtocolOf(media_type) == subprotocol {
+            return CodecFor(media_type)
+        }
+    }
+
+    return nil
+}
+
+func (h *WsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    conn, err := h.Upgrader.Upgrade(w, r, nil)
+    if err != nil {
+        // Upgrade already answered with an HTTP error
+        return
+    }
+
+    c := &WsConn{conn: conn}
+
+    if c.codec = wsCodecOf(conn.Subprotocol()); c.codec == nil {
+        // Falls back to the default codec when nothing acceptable is offered
+        c.codec, _ = responseCodec(r)
+    }
+
+    c.r = r.WithContext(context.WithValue(r.Context(), wsConnKey, c))
+
+    if limit := configOf(r).maxBodySize(); limit > 0 {
+        conn.SetReadLimit(limit)
+    }
+
+    if h.Hub != nil {
+        h.Hub.Register(c)
+        defer h.Hub.Unregister(c)
+    }
+
+    h.serve(c)
+}
+
+// Reads requests until the connection fails, then waits for the pending
+// handlers and closes it.
+func (h *WsHandler) serve(c *WsConn) {
+    var wg sync.WaitGroup
+
+    max_in_flight := h.MaxInFlight
+    if max_in_flight <= 0 {
+        max_in_flight = DefaultWsMaxInFlight
+    }
+
+    in_flight := make(chan struct{}, max_in_flight)
+
+    defer func() {
+        wg.Wait()
+        c.Close()
+    }()
+
+    for {
+        _, raw, err := c.conn.ReadMessage()
+        if err != nil {
+            return
+        }
+
+        in_flight <- struct{}{}
+
+        wg.Add(1)
+        go func(raw []byte) {
+            defer func() {
+                <-in_flight
+                wg.Done()
+            }()
+            h.serveMessage(raw, c)
+        }(raw)
+    }
+}
+
+// Answers a single message, which holds either a request or a batch. A
+// panicking handler is answered with InternalError instead of ending the
+// process, unless it handled a notification.
+func (h *WsHandler) serveMessage(raw []byte, c *WsConn) {
+    start_time := time.Now()
+
+    var id interface{}
+    var method string
+    notification := false
+
+    defer func() {
+        if recover() != nil && !notification {
+            err_d := newErr(InternalError, "standard-errors.InternalError", langOf(c.r))
+            sendWsResponse(nil, err_d, start_time, c, &LogEntry{Method: method, Id: id})
+        }
+    }()
+
+    body, err := decodeBody(raw, c.codec)
+    if err != nil {
+        SendWsParseError(start_time, c, nil)
+        return
+    }
+
+    if batch, ok := body.([]interface{}); ok {
+        if len(batch) == 0 {
+            SendWsInvalidRequest(start_time, c, nil)
+            return
+        }
+
+        if results, calls := h.Mux.dispatchBatch(batch, c.codec, c.r); len(results) > 0 {
+            c.send(results, start_time, &LogEntry{Batch: len(results), calls: calls})
+        }
+        return
+    }
+
+    req, err := parseEnvelope(body)
+    if err != nil {
+        SendWsInvalidRequest(start_time, c, req.Id)
+        return
+    }
+
+    req.codec = c.codec
+    id, notification = req.Id, req.IsNotification()
+    method = h.Mux.methodName(req.Method)
+
+    data, err_d := h.Mux.dispatch(req, withRequest(c.r, req, method))
+    if req.IsNotification() {
+        return
+    }
+
+    e := &LogEntry{Method: method, Id: req.Id}
+
+    if err_d != nil {
+        sendWsResponse(nil, err_d, start_time, c, e)
+        return
+    }
+
+    sendWsResponse(data, nil, start_time, c, e)
+}
@@ -0,0 +1,266 @@
+package sdtp
+
+import (
+    "time"
+    "reflect"
+    "strings"
+    "testing"
+    "net/http"
+    "encoding/json"
+    "net/http/httptest"
+
+    "github.com/gorilla/websocket"
+)
+
+// Starts a server for h and dials it with the JSON subprotocol.
+func dialWs(t *testing.T, h http.Handler) *websocket.Conn {
+    t.Helper()
+
+    srv := httptest.NewServer(h)
+    t.Cleanup(srv.Close)
+
+    d := websocket.Dialer{Subprotocols: []string{WsProtocolJson}}
+
+    conn, _, err := d.Dial("ws" + strings.TrimPrefix(srv.URL, "http"), nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { conn.Close() })
+
+    if conn.Subprotocol() != WsProtocolJson {
+        t.Fatalf("subprotocol = %q, want %q", conn.Subprotocol(), WsProtocolJson)
+    }
+
+    return conn
+}
+
+func writeWs(t *testing.T, conn *websocket.Conn, message string) {
+    t.Helper()
+
+    if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// Reads a message and decodes it into v.
+func readWs(t *testing.T, conn *websocket.Conn, v interface{}) {
+    t.Helper()
+
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+    message_type, raw, err := conn.ReadMessage()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if message_type != websocket.TextMessage {
+        t.Fatalf("message type = %d, want text", message_type)
+    }
+
+    if err := json.Unmarshal(raw, v); err != nil {
+        t.Fatalf("%v: %s", err, raw)
+    }
+}
+
+// Returns the code of the error of a response, 0 when it has none.
+func responseCode(response map[string]interface{}) int {
+    err_d, _ := response["error"].(map[string]interface{})
+    code, _ := err_d["code"].(float64)
+
+    return int(code)
+}
+
+func newTestMux() *Mux {
+    m := NewMux()
+
+    m.HandleFunc("echo", func(req *Request, r *http.Request) (interface{}, error) {
+        return req.Params, nil
+    })
+
+    // Answers after the given number of milliseconds
+    m.HandleFunc("sleep", func(req *Request, r *http.Request) (interface{}, error) {
+        params, _ := req.Params.(map[string]interface{})
+        ms, _ := toInt(params["ms"])
+        time.Sleep(time.Duration(ms) * time.Millisecond)
+        return ms, nil
+    })
+
+    m.HandleFunc("fail", func(req *Request, r *http.Request) (interface{}, error) {
+        return nil, NewNotFound()
+    })
+
+    m.HandleFunc("panic", func(req *Request, r *http.Request) (interface{}, error) {
+        panic("handler panic")
+    })
+
+    return m
+}
+
+func TestWsCorrelatesResponsesById(t *testing.T) {
+    conn := dialWs(t, NewWsHandler(newTestMux()))
+
+    // The slow request is answered last
+    writeWs(t, conn, `{"id": "slow", "method": "sleep", "params": {"ms": 200}}`)
+    writeWs(t, conn, `{"id": 2, "method": "sleep", "params": {"ms": 0}}`)
+
+    var first, second map[string]interface{}
+    readWs(t, conn, &first)
+    readWs(t, conn, &second)
+
+    if first["id"] != float64(2) || first["result"] != float64(0) {
+        t.Errorf("first response = %v, want id 2", first)
+    }
+
+    if second["id"] != "slow" || second["result"] != float64(200) {
+        t.Errorf("second response = %v, want id slow", second)
+    }
+}
+
+func TestWsErrors(t *testing.T) {
+    conn := dialWs(t, NewWsHandler(newTestMux()))
+
+    tests := []struct {
+        message string
+        id      interface{}
+        code    int
+    }{
+        {`{"id": 1, "method": "echo"`, nil, ParseError},
+        {`{"id": 2}`, float64(2), InvalidRequest},
+        {`[]`, nil, InvalidRequest},
+        {`{"id": 3, "method": "missing"}`, float64(3), MethodNotFound},
+        {`{"id": 4, "method": "fail"}`, float64(4), NotFound},
+        {`{"id": 5, "method": "panic"}`, float64(5), InternalError},
+    }
+
+    for _, test := range tests {
+        writeWs(t, conn, test.message)
+
+        var response map[string]interface{}
+        readWs(t, conn, &response)
+
+        if response["id"] != test.id || responseCode(response) != test.code {
+            t.Errorf("%s: response = %v, want id %v and code %d", test.message, response, test.id, test.code)
+        }
+    }
+}
+
+func TestWsBatch(t *testing.T) {
+    conn := dialWs(t, NewWsHandler(newTestMux()))
+
+    writeWs(t, conn, `[
+        {"id": 1, "method": "echo", "params": ["a"]},
+        {"method": "echo", "params": ["notification"]},
+        {"id": 2, "method": "missing"},
+        {"id": 3, "method": "echo", "params": ["c"]}
+    ]`)
+
+    var responses []map[string]interface{}
+    readWs(t, conn, &responses)
+
+    if len(responses) != 3 {
+        t.Fatalf("responses = %v, want 3 of them", responses)
+    }
+
+    if responses[0]["id"] != float64(1) || !reflect.DeepEqual(responses[0]["result"], []interface{}{"a"}) {
+        t.Errorf("responses[0] = %v", responses[0])
+    }
+
+    if responses[1]["id"] != float64(2) || responseCode(responses[1]) != MethodNotFound {
+        t.Errorf("responses[1] = %v", responses[1])
+    }
+
+    if responses[2]["id"] != float64(3) || !reflect.DeepEqual(responses[2]["result"], []interface{}{"c"}) {
+        t.Errorf("responses[2] = %v", responses[2])
+    }
+}
+
+func TestWsNotificationsAreNotAnswered(t *testing.T) {
+    conn := dialWs(t, NewWsHandler(newTestMux()))
+
+    writeWs(t, conn, `{"method": "echo", "params": [1]}`)
+    writeWs(t, conn, `{"method": "panic"}`)
+    writeWs(t, conn, `[{"method": "echo"}, {"method": "echo"}]`)
+    // Answered late enough for any other response to come first
+    writeWs(t, conn, `{"id": "last", "method": "sleep", "params": {"ms": 100}}`)
+
+    var response map[string]interface{}
+    readWs(t, conn, &response)
+
+    if response["id"] != "last" {
+        t.Errorf("response = %v, want the one of id last only", response)
+    }
+}
+
+func TestWsMaxInFlight(t *testing.T) {
+    h := NewWsHandler(newTestMux())
+    h.MaxInFlight = 1
+
+    conn := dialWs(t, h)
+
+    // Handled one at a time, so in order
+    writeWs(t, conn, `{"id": "slow", "method": "sleep", "params": {"ms": 100}}`)
+    writeWs(t, conn, `{"id": "fast", "method": "sleep", "params": {"ms": 0}}`)
+
+    var first, second map[string]interface{}
+    readWs(t, conn, &first)
+    readWs(t, conn, &second)
+
+    if first["id"] != "slow" || second["id"] != "fast" {
+        t.Errorf("responses = %v, %v, want slow then fast", first, second)
+    }
+}
+
+func TestWsReadLimit(t *testing.T) {
+    config := &Config{MaxBodySize: 64}
+    conn := dialWs(t, config.Wrap(NewWsHandler(newTestMux())))
+
+    writeWs(t, conn, `{"id": 1, "method": "echo", "params": ["` + strings.Repeat("x", 128) + `"]}`)
+
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+    if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+        t.Errorf("err = %v, want close for a message too big", err)
+    }
+}
+
+func TestWsLogsMethods(t *testing.T) {
+    m := NewMetricsCollector()
+    conn := dialWs(t, (&Config{Metrics: m}).Wrap(NewWsHandler(newTestMux())))
+
+    writeWs(t, conn, `{"id": 1, "method": "echo", "params": []}`)
+    writeWs(t, conn, `{"id": 2, "method": "panic"}`)
+    writeWs(t, conn, `[{"id": 3, "method": "fail"}, {"id": 4, "method": "missing"}]`)
+
+    // Answered in any order
+    for i := 0; i < 3; i++ {
+        var response interface{}
+        readWs(t, conn, &response)
+    }
+
+    // Responses are observed once written, so maybe after they are read
+    var exposition string
+    for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+        var b strings.Builder
+        m.WriteTo(&b)
+
+        if exposition = b.String(); strings.Count(exposition, "sdtp_responses_total{") == 4 {
+            break
+        }
+    }
+
+    for _, line := range []string{
+        `sdtp_responses_total{method="echo",code="0",encoding="json"} 1`,
+        `sdtp_responses_total{method="panic",code="-32603",encoding="json"} 1`,
+        `sdtp_responses_total{method="fail",code="-404",encoding="json"} 1`,
+        `sdtp_responses_total{method="",code="-32601",encoding="json"} 1`,
+    } {
+        if !strings.Contains(exposition, line) {
+            t.Errorf("exposition misses %s:\n%s", line, exposition)
+        }
+    }
+
+    // The batch itself is not observed, its calls are
+    if n := strings.Count(exposition, "sdtp_responses_total{"); n != 4 {
+        t.Errorf("exposition holds %d response series, want 4:\n%s", n, exposition)
+    }
+}
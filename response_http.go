@@ -3,24 +3,19 @@
  * Copyright © 2017 Weyboo
  * 
  * Return:
- *  Content-type :: "application/json; charset=utf-8", "application/msgpack" (default)
+ *  Content-type :: any registered codec, "application/json; charset=utf-8", "application/msgpack" (default)
  * 
  * Request:
- *  Content-type :: "application/json;", "application/msgpack"
- *  Accept :: "application/json"
+ *  Content-type :: any registered codec, "application/json;", "application/msgpack"
+ *  Accept :: media types of the registered codecs, with q-values and wildcards
  */
 
 package sdtp
 
 import (
     "time"
+    "strings"
     "net/http"
-    "encoding/json"
-    
-	"github.com/vmihailenco/msgpack"
-    
-    "github.com/iurybraun/go-cfg_ini"
-    "github.com/iurybraun/i18n_ini"
 )
 
 func SendHttpData(data interface{}, start_time time.Time, w http.ResponseWriter, r *http.Request) {
@@ -32,63 +27,96 @@ func SendHttpData(data interface{}, start_time time.Time, w http.ResponseWriter,
     
     result_map := New()
     
+    AddId(result_map, RequestId(r))
     AddResult(result_map, data)
     
-    if r.Header.Get("Accept") == "application/json" {
-        msgjson, err := json.Marshal(result_map)
-        if err != nil {
-            SendHttpInternalError(start_time, w, r)
-            return
-        }
-        
-        w.Header().Set("Content-Type", "application/json; charset=utf-8")
-        w.Write(msgjson)
-        
-        //logsHttpCreate(nil, start_time, int32(len(msgjson)), w, r)
-    } else {
-        msgpk, err := msgpack.Marshal(result_map)
-        if err != nil {
-            SendHttpInternalError(start_time, w, r)
-            return
-        }
-        
-        w.Header().Set("Content-Type", "application/msgpack")
-        w.Write(msgpk)
-        
-        //logsHttpCreate(nil, start_time, int32(len(msgpk)), w, r)
+    if err := writeHttp(result_map, &LogEntry{}, start_time, w, r); err != nil {
+        SendHttpInternalError(start_time, w, r)
+        return
     }
 }
 
+// SendHttpNoContent answers a notification, which carries no response body.
+func SendHttpNoContent(start_time time.Time, w http.ResponseWriter, r *http.Request) {
+    setTimingHeaders(start_time, w, r)
+    w.WriteHeader(http.StatusNoContent)
+    
+    observeResponse(r, start_time, &LogEntry{Method: methodOf(r), Id: RequestId(r)})
+}
+
 func sendHttpErr(err_d interface{}, start_time time.Time, w http.ResponseWriter, r *http.Request) {
     result_map := New()
     
+    AddId(result_map, RequestId(r))
     AddError(result_map, err_d)
     
-    if r.Header.Get("Accept") == "application/json" {
-        msgjson, err := json.Marshal(result_map)
-        if err != nil {
-            w.Header().Set("Content-Type", "application/json; charset=utf-8")
-            w.Write(nil)
-            return
-        }
-        
-        w.Header().Set("Content-Type", "application/json; charset=utf-8")
-        w.Write(msgjson)
-        
-        //logsHttpCreate(err_d, start_time, int32(len(msgjson)), w, r)
-    } else {
-        msgpk, err := msgpack.Marshal(result_map)
-        if err != nil {
-            w.Header().Set("Content-Type", "application/msgpack")
-            w.Write(nil)
-            return
-        }
+    if err := writeHttp(result_map, &LogEntry{Code: codeOf(err_d)}, start_time, w, r); err != nil {
+        w.Write(nil)
+        return
+    }
+}
+
+// Returns the codec of the response to r, negotiated from its Accept header
+// among the registered codecs. The second value is false when none is
+// acceptable, the default codec is then returned.
+func responseCodec(r *http.Request) (Codec, bool) {
+    media_type, ok := negotiate(strings.Join(r.Header.Values("Accept"), ","), codecMediaTypes())
+    if !ok {
+        return defaultCodec(), false
+    }
+    
+    return CodecFor(media_type), true
+}
+
+// Encodes v with the codec negotiated from the Accept header, writes it and
+// logs the response described by e. When the client accepts no codec a
+// NotAcceptable error is written instead, with the default codec. An error
+// is returned only when v cannot be encoded, nothing but the Content-Type is
+// set then, so the caller can still answer. A failed write is not reported,
+// the response cannot be answered anymore.
+func writeHttp(v interface{}, e *LogEntry, start_time time.Time, w http.ResponseWriter, r *http.Request) error {
+    codec, ok := responseCodec(r)
+    
+    if !ok {
+        result_map := New()
         
-        w.Header().Set("Content-Type", "application/msgpack")
-        w.Write(msgpk)
+        AddId(result_map, RequestId(r))
+        AddError(result_map, newErr(NotAcceptable, "resource-errors.NotAcceptable", langOf(r)))
         
-        //logsHttpCreate(err_d, start_time, int32(len(msgpk)), w, r)
+        v = result_map
+        e = &LogEntry{Code: NotAcceptable}
+    }
+    
+    w.Header().Set("Content-Type", codec.ContentType())
+    
+    stop := timingOf(r).Start(PhaseEncode)
+    raw, err := codec.Marshal(v)
+    stop()
+    
+    if err != nil {
+        return err
     }
+    
+    setTimingHeaders(start_time, w, r)
+    
+    size, _ := w.Write(raw)
+    
+    e.Method = methodOf(r)
+    e.Id = RequestId(r)
+    e.Size = size
+    e.Encoding = mediaTypeOf(codec.ContentType())
+    
+    observeResponse(r, start_time, e)
+    
+    return nil
+}
+
+
+
+// SendHttpError sends the error object of err. Errors that are not SDTP
+// errors are sent as InternalError.
+func SendHttpError(err error, start_time time.Time, w http.ResponseWriter, r *http.Request) {
+    sendHttpErr(errorObject(err, langOf(r)), start_time, w, r)
 }
 
 
@@ -97,68 +125,23 @@ func sendHttpErr(err_d interface{}, start_time time.Time, w http.ResponseWriter,
  * Standard errors
  */
 func SendHttpParseError(start_time time.Time, w http.ResponseWriter, r *http.Request) {
-    var lang = cfg_ini.GetLang(r)
-    
-    sendHttpErr(
-        map[string]interface{}{
-            "code": ParseError,
-            "message": i18n_ini.LoadTr(lang, "standard-errors.ParseError"),
-        }, start_time, w, r)
+    sendHttpErr(newErr(ParseError, "standard-errors.ParseError", langOf(r)), start_time, w, r)
 }
 
 func SendHttpInvalidRequest(start_time time.Time, w http.ResponseWriter, r *http.Request) {
-    var lang = cfg_ini.GetLang(r)
-    
-    sendHttpErr(
-        map[string]interface{}{
-            "code": InvalidRequest,
-            "message": i18n_ini.LoadTr(lang, "standard-errors.InvalidRequest"),
-        }, start_time, w, r)
+    sendHttpErr(newErr(InvalidRequest, "standard-errors.InvalidRequest", langOf(r)), start_time, w, r)
 }
 
 func SendHttpMethodNotFound(start_time time.Time, w http.ResponseWriter, r *http.Request) {
-    var lang = cfg_ini.GetLang(r)
-    
-    sendHttpErr(
-        map[string]interface{}{
-            "code": MethodNotFound,
-            "message": i18n_ini.LoadTr(lang, "standard-errors.MethodNotFound"),
-        }, start_time, w, r)
+    sendHttpErr(newErr(MethodNotFound, "standard-errors.MethodNotFound", langOf(r)), start_time, w, r)
 }
 
 func SendHttpSingleInvalidParams(parameter_error int, location string, start_time time.Time, w http.ResponseWriter, r *http.Request) {
-    var lang = cfg_ini.GetLang(r)
-    var message_parameter_error string
-    
-    switch parameter_error {
-        case 1:
-            message_parameter_error = i18n_ini.LoadTr(lang, "parameter-errors.Required")
-        break;
-        case 2:
-            message_parameter_error = i18n_ini.LoadTr(lang, "parameter-errors.TooLow")
-        break;
-        case 3:
-            message_parameter_error = i18n_ini.LoadTr(lang, "parameter-errors.LimitExceeded")
-        break;
-        case 4:
-            message_parameter_error = i18n_ini.LoadTr(lang, "parameter-errors.Rejected")
-        break;
-    }
+    var lang = langOf(r)
     
-    
-    err_map := NewErrorData()
-    err_map = AddErrorData(err_map, map[string]interface{}{
-            "code": parameter_error,
-            "location": location,
-            "message": message_parameter_error,
-        })
-
     sendHttpErr(
-        map[string]interface{}{
-            "code": InvalidParams,
-            "message": i18n_ini.LoadTr(lang, "standard-errors.InvalidParams"),
-            "data": err_map,
-        }, start_time, w, r)
+        newDataErr(InvalidParams, "standard-errors.InvalidParams",
+            newParamErrData(parameter_error, location, lang), lang), start_time, w, r)
 }
 
 /*
@@ -172,24 +155,11 @@ func SendHttpSingleInvalidParams(parameter_error int, location string, start_tim
     SendHttpMultipleInvalidParams(err_map, w, r)
 */
 func SendHttpMultipleInvalidParams(err_map E1, start_time time.Time, w http.ResponseWriter, r *http.Request) {
-    var lang = cfg_ini.GetLang(r)
-    
-    sendHttpErr(
-        map[string]interface{}{
-            "code": InvalidParams,
-            "message": i18n_ini.LoadTr(lang, "standard-errors.InvalidParams"),
-            "data": err_map,
-        }, start_time, w, r)
+    sendHttpErr(newDataErr(InvalidParams, "standard-errors.InvalidParams", err_map, langOf(r)), start_time, w, r)
 }
 
 func SendHttpInternalError(start_time time.Time, w http.ResponseWriter, r *http.Request) {
-    var lang = cfg_ini.GetLang(r)
-    
-    sendHttpErr(
-        map[string]interface{}{
-            "code": InternalError,
-            "message": i18n_ini.LoadTr(lang, "standard-errors.InternalError"),
-        }, start_time, w, r)
+    sendHttpErr(newErr(InternalError, "standard-errors.InternalError", langOf(r)), start_time, w, r)
 }
 
 
@@ -197,65 +167,19 @@ func SendHttpInternalError(start_time time.Time, w http.ResponseWriter, r *http.
  * Security errors
  */
 func SendHttpUnauthorized(message string, start_time time.Time, w http.ResponseWriter, r *http.Request) {
-    var lang = cfg_ini.GetLang(r)
-    var message_t string
-    
-    if message != "" {
-        message_t = message
-    } else {
-        message_t = i18n_ini.LoadTr(lang, "security-errors.Unauthorized")
-    }
-    
-    sendHttpErr(
-        map[string]interface{}{
-            "code": Unauthorized,
-            "message": message_t,
-        }, start_time, w, r)
+    sendHttpErr(newMessageErr(Unauthorized, message, "security-errors.Unauthorized", langOf(r)), start_time, w, r)
 }
 
 func SendHttpSingleUnauthorized(parameter_error int, location string, start_time time.Time, w http.ResponseWriter, r *http.Request) {
-    var lang = cfg_ini.GetLang(r)
-    var message_parameter_error string
-    
-    switch parameter_error {
-        case 1:
-            message_parameter_error = i18n_ini.LoadTr(lang, "parameter-errors.Required")
-        break;
-        case 2:
-            message_parameter_error = i18n_ini.LoadTr(lang, "parameter-errors.TooLow")
-        break;
-        case 3:
-            message_parameter_error = i18n_ini.LoadTr(lang, "parameter-errors.LimitExceeded")
-        break;
-        case 4:
-            message_parameter_error = i18n_ini.LoadTr(lang, "parameter-errors.Rejected")
-        break;
-    }
-    
+    var lang = langOf(r)
     
-    err_map := NewErrorData()
-    err_map = AddErrorData(err_map, map[string]interface{}{
-            "code": parameter_error,
-            "location": location,
-            "message": message_parameter_error,
-        })
-
     sendHttpErr(
-        map[string]interface{}{
-            "code": Unauthorized,
-            "message": i18n_ini.LoadTr(lang, "security-errors.Unauthorized"),
-            "data": err_map,
-        }, start_time, w, r)
+        newDataErr(Unauthorized, "security-errors.Unauthorized",
+            newParamErrData(parameter_error, location, lang), lang), start_time, w, r)
 }
 
 func SendHttpForbidden(start_time time.Time, w http.ResponseWriter, r *http.Request) {
-    var lang = cfg_ini.GetLang(r)
-    
-    sendHttpErr(
-        map[string]interface{}{
-            "code": Forbidden,
-            "message": i18n_ini.LoadTr(lang, "security-errors.Forbidden"),
-        }, start_time, w, r)
+    sendHttpErr(newErr(Forbidden, "security-errors.Forbidden", langOf(r)), start_time, w, r)
 }
 
 
@@ -264,13 +188,24 @@ func SendHttpForbidden(start_time time.Time, w http.ResponseWriter, r *http.Requ
  * Resource errors
  */
 func SendHttpNotFound(start_time time.Time, w http.ResponseWriter, r *http.Request) {
-    var lang = cfg_ini.GetLang(r)
-    
-    sendHttpErr(
-        map[string]interface{}{
-            "code": NotFound,
-            "message": i18n_ini.LoadTr(lang, "resource-errors.NotFound"),
-        }, start_time, w, r)
+    sendHttpErr(newErr(NotFound, "resource-errors.NotFound", langOf(r)), start_time, w, r)
+}
+
+func SendHttpNotAcceptable(start_time time.Time, w http.ResponseWriter, r *http.Request) {
+    sendHttpErr(newErr(NotAcceptable, "resource-errors.NotAcceptable", langOf(r)), start_time, w, r)
+}
+
+// Answers NotAcceptable when the client accepts none of the registered
+// codecs and returns false, so that no handler is run for a response the
+// client could not read.
+func acceptHttp(start_time time.Time, w http.ResponseWriter, r *http.Request) bool {
+    if _, ok := responseCodec(r); ok {
+        return true
+    }
+
+    SendHttpNotAcceptable(start_time, w, r)
+
+    return false
 }
 
 
@@ -279,48 +214,19 @@ func SendHttpNotFound(start_time time.Time, w http.ResponseWriter, r *http.Reque
  * Process errors
  */
 func SendHttpConflict(message string, start_time time.Time, w http.ResponseWriter, r *http.Request) {
-    var lang = cfg_ini.GetLang(r)
-    var message_t string
-    
-    if message != "" {
-        message_t = message
-    } else {
-        message_t = i18n_ini.LoadTr(lang, "process-errors.Conflict")
-    }
-    
-    sendHttpErr(
-        map[string]interface{}{
-            "code": Conflict,
-            "message": message_t,
-        }, start_time, w, r)
+    sendHttpErr(newMessageErr(Conflict, message, "process-errors.Conflict", langOf(r)), start_time, w, r)
 }
 
 func SendHttpSingleConflict(location string, start_time time.Time, w http.ResponseWriter, r *http.Request) {
-    var lang = cfg_ini.GetLang(r)
+    var lang = langOf(r)
     
-    err_map := NewErrorData()
-    err_map = AddErrorData(err_map, map[string]interface{}{
-            "code": 4,
-            "location": location,
-            "message": i18n_ini.LoadTr(lang, "parameter-errors.Rejected"),
-        })
-
     sendHttpErr(
-        map[string]interface{}{
-            "code": Conflict,
-            "message": i18n_ini.LoadTr(lang, "process-errors.Conflict"),
-            "data": err_map,
-        }, start_time, w, r)
+        newDataErr(Conflict, "process-errors.Conflict",
+            newParamErrData(Rejected, location, lang), lang), start_time, w, r)
 }
 
 func SendHttpUnprocessableEntity(start_time time.Time, w http.ResponseWriter, r *http.Request) {
-    var lang = cfg_ini.GetLang(r)
-    
-    sendHttpErr(
-        map[string]interface{}{
-            "code": UnprocessableEntity,
-            "message": i18n_ini.LoadTr(lang, "process-errors.UnprocessableEntity"),
-        }, start_time, w, r)
+    sendHttpErr(newErr(UnprocessableEntity, "process-errors.UnprocessableEntity", langOf(r)), start_time, w, r)
 }
 
 
@@ -0,0 +1,216 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ *
+ * Return:
+ *  {"id": <ID>, "result": [<ITEM>, ...]}
+ *  {"id": <ID>, "result": [<ITEM>, ...], "error": <ERROR>}, when the producer fails midway
+ *
+ * msgpack streams only with a known count of items (SendHttpStreamCount),
+ * its envelope then always holds "error", nil unless the producer failed.
+ */
+
+package sdtp
+
+import (
+    "io"
+    "time"
+    "errors"
+    "net/http"
+)
+
+// StreamFunc produces the items of a streamed result, calling yield for each
+// of them. Returning a non nil error ends the result with a trailing error
+// object. An error returned by yield means the response cannot be written
+// anymore, the producer should stop and return it.
+type StreamFunc func(yield func(item interface{}) error) error
+
+// ChanStream returns a StreamFunc reading items until the channel is closed,
+// then the producer error from errc, when errc is not nil.
+func ChanStream(items <-chan interface{}, errc <-chan error) StreamFunc {
+    return func(yield func(item interface{}) error) error {
+        for item := range items {
+            if err := yield(item); err != nil {
+                return err
+            }
+        }
+
+        if errc == nil {
+            return nil
+        }
+
+        return <-errc
+    }
+}
+
+// SendHttpStream sends the items produced as the result array, writing each
+// item as soon as it is produced. Codecs that cannot stream without knowing
+// the number of items, as msgpack, the default one, get the items buffered
+// and sent at once: use SendHttpStreamCount when the count is known.
+func SendHttpStream(produce StreamFunc, start_time time.Time, w http.ResponseWriter, r *http.Request) {
+    sendHttpStream(-1, produce, start_time, w, r)
+}
+
+// SendHttpStreamCount sends the count items produced as the result array,
+// writing each item as soon as it is produced, with msgpack too. A producer
+// yielding more or less than count items gets the result ended by an
+// InternalError.
+func SendHttpStreamCount(count int, produce StreamFunc, start_time time.Time, w http.ResponseWriter, r *http.Request) {
+    if count < 0 {
+        count = 0
+    }
+
+    sendHttpStream(count, produce, start_time, w, r)
+}
+
+// Sends the items produced, count being -1 when it is not known.
+func sendHttpStream(count int, produce StreamFunc, start_time time.Time, w http.ResponseWriter, r *http.Request) {
+    codec, ok := responseCodec(r)
+    if !ok {
+        SendHttpNotAcceptable(start_time, w, r)
+        return
+    }
+
+    produce = countedStream(count, produce)
+
+    cw := &countingWriter{w: w}
+
+    var enc StreamEncoder
+    if sc, ok := codec.(SizedStreamCodec); ok && count >= 0 {
+        enc = sc.NewSizedStreamEncoder(cw, count)
+    } else if sc, ok := codec.(StreamCodec); ok {
+        enc = sc.NewStreamEncoder(cw)
+    } else {
+        sendHttpBufferedStream(produce, start_time, w, r)
+        return
+    }
+
+    w.Header().Set("Content-Type", codec.ContentType())
+    setTimingHeaders(start_time, w, r)
+
+    if err := enc.Begin(RequestId(r)); err != nil {
+        return
+    }
+
+    var write_err, encode_err error
+
+    err := produce(func(item interface{}) error {
+        if write_err != nil {
+            return write_err
+        }
+        if encode_err != nil {
+            return encode_err
+        }
+
+        item_err := enc.Item(item)
+
+        var e *EncodeError
+        if errors.As(item_err, &e) {
+            encode_err = item_err
+        } else {
+            write_err = item_err
+        }
+
+        return item_err
+    })
+
+    if write_err != nil {
+        return
+    }
+
+    // The result is ended with an InternalError, not the producer error
+    if encode_err != nil {
+        err = encode_err
+    }
+
+    var err_d interface{}
+    if err != nil {
+        err_d = errorObject(err, langOf(r))
+    }
+
+    if enc.End(err_d) != nil {
+        return
+    }
+
+    observeResponse(r, start_time, &LogEntry{
+        Method: methodOf(r),
+        Id: RequestId(r),
+        Code: codeOf(err_d),
+        Size: cw.n,
+        Encoding: mediaTypeOf(codec.ContentType()),
+    })
+}
+
+// Returned when a producer yields more or less items than its count.
+var errStreamCount = errors.New("sdtp: stream items do not match its count")
+
+// Returns produce failing with errStreamCount when it yields other than count
+// items. Items past count are not passed to yield.
+func countedStream(count int, produce StreamFunc) StreamFunc {
+    if count < 0 {
+        return produce
+    }
+
+    return func(yield func(item interface{}) error) error {
+        items := 0
+
+        err := produce(func(item interface{}) error {
+            if items >= count {
+                items = count + 1
+                return errStreamCount
+            }
+
+            items++
+
+            return yield(item)
+        })
+
+        if err == nil && items != count {
+            return errStreamCount
+        }
+
+        return err
+    }
+}
+
+// Counts the bytes written through it.
+type countingWriter struct {
+    w io.Writer
+    n int
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+    n, err := cw.w.Write(p)
+    cw.n += n
+
+    return n, err
+}
+
+// Collects the produced items and sends them as a single result.
+func sendHttpBufferedStream(produce StreamFunc, start_time time.Time, w http.ResponseWriter, r *http.Request) {
+    items := make([]interface{}, 0)
+
+    err := produce(func(item interface{}) error {
+        items = append(items, item)
+        return nil
+    })
+
+    result_map := New()
+
+    AddId(result_map, RequestId(r))
+    AddResult(result_map, items)
+
+    e := &LogEntry{}
+
+    if err != nil {
+        err_d := errorObject(err, langOf(r))
+
+        AddError(result_map, err_d)
+        e.Code = codeOf(err_d)
+    }
+
+    if err := writeHttp(result_map, e, start_time, w, r); err != nil {
+        SendHttpInternalError(start_time, w, r)
+        return
+    }
+}
@@ -0,0 +1,154 @@
+package sdtp
+
+import (
+    "time"
+    "errors"
+    "reflect"
+    "testing"
+    "net/http/httptest"
+)
+
+// Streams produce with msgpack and decodes the response.
+func streamMsgpack(t *testing.T, count int, produce StreamFunc) map[string]interface{} {
+    t.Helper()
+
+    r := httptest.NewRequest("POST", "/", nil)
+    r.Header.Set("Accept", "application/msgpack")
+
+    w := httptest.NewRecorder()
+    SendHttpStreamCount(count, produce, time.Now(), w, r)
+
+    var response map[string]interface{}
+    if err := (MsgpackCodec{}).Unmarshal(w.Body.Bytes(), &response); err != nil {
+        t.Fatalf("%v: %x", err, w.Body.Bytes())
+    }
+
+    return response
+}
+
+// Yields the given items, then returns err.
+func yieldAll(err error, items ...interface{}) StreamFunc {
+    return func(yield func(item interface{}) error) error {
+        for _, item := range items {
+            if err := yield(item); err != nil {
+                return err
+            }
+        }
+
+        return err
+    }
+}
+
+func TestMsgpackStreamCount(t *testing.T) {
+    response := streamMsgpack(t, 3, yieldAll(nil, "a", "b", "c"))
+
+    if !reflect.DeepEqual(response["result"], []interface{}{"a", "b", "c"}) || response["error"] != nil {
+        t.Errorf("response = %v, want the 3 items and no error", response)
+    }
+}
+
+func TestMsgpackStreamTrailingError(t *testing.T) {
+    response := streamMsgpack(t, 3, yieldAll(NewNotFound(), "a"))
+
+    // Missing items are padded
+    if !reflect.DeepEqual(response["result"], []interface{}{"a", nil, nil}) {
+        t.Errorf("result = %v, want a padded with nil", response["result"])
+    }
+
+    if err_d, _ := response["error"].(map[string]interface{}); toCode(err_d["code"]) != NotFound {
+        t.Errorf("error = %v, want NotFound", response["error"])
+    }
+}
+
+func TestMsgpackStreamCountMismatch(t *testing.T) {
+    for _, produce := range []StreamFunc{yieldAll(nil, "a"), yieldAll(nil, "a", "b", "c")} {
+        response := streamMsgpack(t, 2, produce)
+
+        if result, _ := response["result"].([]interface{}); len(result) != 2 {
+            t.Errorf("result = %v, want 2 items", response["result"])
+        }
+
+        if err_d, _ := response["error"].(map[string]interface{}); toCode(err_d["code"]) != InternalError {
+            t.Errorf("error = %v, want InternalError", response["error"])
+        }
+    }
+}
+
+func TestJsonStreamCountMismatch(t *testing.T) {
+    r := httptest.NewRequest("POST", "/", nil)
+    r.Header.Set("Accept", "application/json")
+
+    w := httptest.NewRecorder()
+    SendHttpStreamCount(1, yieldAll(errors.New("ignored"), "a", "b"), time.Now(), w, r)
+
+    want := `{"id":null,"result":["a"],"error":`
+    if got := w.Body.String(); len(got) < len(want) || got[:len(want)] != want {
+        t.Errorf("body = %s, want it to start with %s", got, want)
+    }
+}
+
+// Returns the integer of a decoded number, 0 when v is none.
+func toCode(v interface{}) int {
+    n, _ := toInt(v)
+
+    return n
+}
+
+func TestStreamUnencodableItem(t *testing.T) {
+    produce := func(yield func(item interface{}) error) error {
+        for _, item := range []interface{}{1, func() {}, 3} {
+            if err := yield(item); err != nil {
+                return err
+            }
+        }
+
+        return nil
+    }
+
+    tests := []struct {
+        accept string
+        count  int
+    }{
+        {"application/json", -1},
+        {"application/cbor", -1},
+        {"application/msgpack", 3},
+    }
+
+    for _, test := range tests {
+        r := httptest.NewRequest("POST", "/", nil)
+        r.Header.Set("Accept", test.accept)
+
+        w := httptest.NewRecorder()
+        if test.count < 0 {
+            SendHttpStream(produce, time.Now(), w, r)
+        } else {
+            SendHttpStreamCount(test.count, produce, time.Now(), w, r)
+        }
+
+        var response map[string]interface{}
+        if err := CodecFor(test.accept).Unmarshal(w.Body.Bytes(), &response); err != nil {
+            t.Fatalf("%s: %v: %q", test.accept, err, w.Body.Bytes())
+        }
+
+        if result, _ := response["result"].([]interface{}); len(result) == 0 || toCode(result[0]) != 1 {
+            t.Errorf("%s: result = %v, want the first item", test.accept, response["result"])
+        }
+
+        if err_d, _ := response["error"].(map[string]interface{}); toCode(err_d["code"]) != InternalError {
+            t.Errorf("%s: error = %v, want InternalError", test.accept, response["error"])
+        }
+    }
+}
+
+func TestJsonStreamUnencodableItemBody(t *testing.T) {
+    r := httptest.NewRequest("POST", "/", nil)
+    r.Header.Set("Accept", "application/json")
+
+    w := httptest.NewRecorder()
+    SendHttpStream(yieldAll(nil, 1, make(chan int), 3), time.Now(), w, r)
+
+    want := `{"id":null,"result":[1],"error":{"code":-32603,"message":"Internal error"}}`
+    if w.Body.String() != want {
+        t.Errorf("body = %s, want %s", w.Body.String(), want)
+    }
+}
@@ -1,8 +1,145 @@
 /*
  * Copyright © 2016 Iury Braun
  * Copyright © 2017 Weyboo
- * 
+ *
  * @Header :: Content-type :: application/json; charset=utf-8, application/msgpack (default)
+ *
+ * Return:
+ *  Text message :: textual codecs (declaring a charset), e.g. JSON on "sdtp.json" connections
+ *  Binary message :: other codecs, e.g. msgpack (default)
  */
 
 package sdtp
+
+import (
+    "time"
+)
+
+func SendWsData(data interface{}, start_time time.Time, c *WsConn, id interface{}) {
+    if data == nil {
+        SendWsInternalError(start_time, c, id)
+        return
+    }
+
+
+    sendWsResponse(data, nil, start_time, c, &LogEntry{Id: id})
+}
+
+func sendWsErr(err_d interface{}, start_time time.Time, c *WsConn, id interface{}) {
+    sendWsResponse(nil, err_d, start_time, c, &LogEntry{Id: id})
+}
+
+// Sends the result data, or the error object err_d when it is not nil, of
+// the call e describes. A result that cannot be sent is answered with
+// InternalError instead.
+func sendWsResponse(data interface{}, err_d interface{}, start_time time.Time, c *WsConn, e *LogEntry) {
+    result_map := New()
+
+    AddId(result_map, e.Id)
+
+    if err_d != nil {
+        AddError(result_map, err_d)
+        e.Code = codeOf(err_d)
+    } else {
+        AddResult(result_map, data)
+    }
+
+    if err := c.send(result_map, start_time, e); err != nil && err_d == nil {
+        sendWsResponse(nil, newErr(InternalError, "standard-errors.InternalError", langOf(c.r)), start_time, c, e)
+    }
+}
+
+
+
+// SendWsError sends the error object of err. Errors that are not SDTP
+// errors are sent as InternalError.
+func SendWsError(err error, start_time time.Time, c *WsConn, id interface{}) {
+    sendWsErr(errorObject(err, langOf(c.r)), start_time, c, id)
+}
+
+
+
+/**
+ * Standard errors
+ */
+func SendWsParseError(start_time time.Time, c *WsConn, id interface{}) {
+    sendWsErr(newErr(ParseError, "standard-errors.ParseError", langOf(c.r)), start_time, c, id)
+}
+
+func SendWsInvalidRequest(start_time time.Time, c *WsConn, id interface{}) {
+    sendWsErr(newErr(InvalidRequest, "standard-errors.InvalidRequest", langOf(c.r)), start_time, c, id)
+}
+
+func SendWsMethodNotFound(start_time time.Time, c *WsConn, id interface{}) {
+    sendWsErr(newErr(MethodNotFound, "standard-errors.MethodNotFound", langOf(c.r)), start_time, c, id)
+}
+
+func SendWsSingleInvalidParams(parameter_error int, location string, start_time time.Time, c *WsConn, id interface{}) {
+    var lang = langOf(c.r)
+
+    sendWsErr(
+        newDataErr(InvalidParams, "standard-errors.InvalidParams",
+            newParamErrData(parameter_error, location, lang), lang), start_time, c, id)
+}
+
+func SendWsMultipleInvalidParams(err_map E1, start_time time.Time, c *WsConn, id interface{}) {
+    sendWsErr(newDataErr(InvalidParams, "standard-errors.InvalidParams", err_map, langOf(c.r)), start_time, c, id)
+}
+
+func SendWsInternalError(start_time time.Time, c *WsConn, id interface{}) {
+    sendWsErr(newErr(InternalError, "standard-errors.InternalError", langOf(c.r)), start_time, c, id)
+}
+
+
+/**
+ * Security errors
+ */
+func SendWsUnauthorized(message string, start_time time.Time, c *WsConn, id interface{}) {
+    sendWsErr(newMessageErr(Unauthorized, message, "security-errors.Unauthorized", langOf(c.r)), start_time, c, id)
+}
+
+func SendWsSingleUnauthorized(parameter_error int, location string, start_time time.Time, c *WsConn, id interface{}) {
+    var lang = langOf(c.r)
+
+    sendWsErr(
+        newDataErr(Unauthorized, "security-errors.Unauthorized",
+            newParamErrData(parameter_error, location, lang), lang), start_time, c, id)
+}
+
+func SendWsForbidden(start_time time.Time, c *WsConn, id interface{}) {
+    sendWsErr(newErr(Forbidden, "security-errors.Forbidden", langOf(c.r)), start_time, c, id)
+}
+
+
+
+/**
+ * Resource errors
+ */
+func SendWsNotFound(start_time time.Time, c *WsConn, id interface{}) {
+    sendWsErr(newErr(NotFound, "resource-errors.NotFound", langOf(c.r)), start_time, c, id)
+}
+
+func SendWsNotAcceptable(start_time time.Time, c *WsConn, id interface{}) {
+    sendWsErr(newErr(NotAcceptable, "resource-errors.NotAcceptable", langOf(c.r)), start_time, c, id)
+}
+
+
+
+/**
+ * Process errors
+ */
+func SendWsConflict(message string, start_time time.Time, c *WsConn, id interface{}) {
+    sendWsErr(newMessageErr(Conflict, message, "process-errors.Conflict", langOf(c.r)), start_time, c, id)
+}
+
+func SendWsSingleConflict(location string, start_time time.Time, c *WsConn, id interface{}) {
+    var lang = langOf(c.r)
+
+    sendWsErr(
+        newDataErr(Conflict, "process-errors.Conflict",
+            newParamErrData(Rejected, location, lang), lang), start_time, c, id)
+}
+
+func SendWsUnprocessableEntity(start_time time.Time, c *WsConn, id interface{}) {
+    sendWsErr(newErr(UnprocessableEntity, "process-errors.UnprocessableEntity", langOf(c.r)), start_time, c, id)
+}
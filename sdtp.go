@@ -23,7 +23,8 @@ func NewErrorData() E1 {
 }
 
 
-func AddId(x R1, value int) {
+// AddId sets the request id, either a string or a number.
+func AddId(x R1, value interface{}) {
     x["id"] = value
 }
 
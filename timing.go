@@ -0,0 +1,132 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ *
+ * Server-Timing :: <PHASE>;dur=<MS>, ..., app;dur=<MS>
+ * X-Response-Time :: <MS>ms
+ */
+
+package sdtp
+
+import (
+    "sync"
+    "time"
+    "context"
+    "strconv"
+    "strings"
+    "net/http"
+)
+
+// Names of the phases recorded by sdtp.
+const (
+    PhaseDecode   = "decode"
+    PhaseValidate = "validate"
+    PhaseHandler  = "handler"
+    PhaseEncode   = "encode"
+)
+
+// Timing records the duration of the named phases of a request, sent in
+// the Server-Timing header. A nil *Timing records nothing, so handlers can
+// use TimingFromContext without checking whether timing is enabled.
+type Timing struct {
+    mu     sync.Mutex
+    phases []timingPhase
+}
+
+type timingPhase struct {
+    name string
+    dur  time.Duration
+}
+
+// TimingFromContext returns the Timing of the request ctx belongs to, or
+// nil when the Config of the request does not enable timing.
+func TimingFromContext(ctx context.Context) *Timing {
+    t, _ := ctx.Value(timingKey).(*Timing)
+
+    return t
+}
+
+// Add adds d to the phase name. Phases recorded more than once, as the
+// handler phase of a batch, are summed.
+func (t *Timing) Add(name string, d time.Duration) {
+    if t == nil {
+        return
+    }
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    for i := range t.phases {
+        if t.phases[i].name == name {
+            t.phases[i].dur += d
+            return
+        }
+    }
+
+    t.phases = append(t.phases, timingPhase{name: name, dur: d})
+}
+
+// Start starts timing the phase name, the returned function stops it.
+//
+//  defer sdtp.TimingFromContext(ctx).Start("db")()
+func (t *Timing) Start(name string) func() {
+    if t == nil {
+        return func() {}
+    }
+
+    start := time.Now()
+
+    return func() {
+        t.Add(name, time.Since(start))
+    }
+}
+
+// Returns the Server-Timing header value, ending with the total app phase.
+func (t *Timing) header(app time.Duration) string {
+    var b strings.Builder
+
+    if t != nil {
+        t.mu.Lock()
+        for _, p := range t.phases {
+            b.WriteString(p.name + ";dur=" + formatMillis(p.dur) + ", ")
+        }
+        t.mu.Unlock()
+    }
+
+    b.WriteString("app;dur=" + formatMillis(app))
+
+    return b.String()
+}
+
+func formatMillis(d time.Duration) string {
+    return strconv.FormatFloat(float64(d) / float64(time.Millisecond), 'f', 3, 64)
+}
+
+// Returns r carrying a new Timing when its Config enables timing and it
+// carries none yet.
+func withTiming(r *http.Request) *http.Request {
+    if !configOf(r).Timing || TimingFromContext(r.Context()) != nil {
+        return r
+    }
+
+    return r.WithContext(context.WithValue(r.Context(), timingKey, &Timing{}))
+}
+
+// Returns the Timing of r, or nil.
+func timingOf(r *http.Request) *Timing {
+    return TimingFromContext(r.Context())
+}
+
+// Sets the Server-Timing and X-Response-Time headers of the response to r,
+// when its Config enables timing. Must be called before the header is
+// written.
+func setTimingHeaders(start_time time.Time, w http.ResponseWriter, r *http.Request) {
+    if !configOf(r).Timing {
+        return
+    }
+
+    elapsed := time.Since(start_time)
+
+    w.Header().Set("Server-Timing", timingOf(r).header(elapsed))
+    w.Header().Set("X-Response-Time", formatMillis(elapsed) + "ms")
+}
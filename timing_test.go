@@ -0,0 +1,126 @@
+package sdtp
+
+import (
+    "time"
+    "regexp"
+    "strings"
+    "testing"
+    "context"
+    "net/http"
+)
+
+// Returns the names of the phases of a Server-Timing header, and their
+// durations.
+func timingPhases(header string) ([]string, map[string]string) {
+    var names []string
+    durs := make(map[string]string)
+
+    for _, phase := range strings.Split(header, ", ") {
+        name, dur, _ := strings.Cut(phase, ";dur=")
+        names = append(names, name)
+        durs[name] = dur
+    }
+
+    return names, durs
+}
+
+// Returns a mux whose "db" method records a db phase twice.
+func newTimingMux() *Mux {
+    m := NewMux()
+
+    m.Handle("db", func(ctx context.Context, req *Request) (interface{}, error) {
+        timing := TimingFromContext(ctx)
+        timing.Add("db", 5 * time.Millisecond)
+        timing.Add("db", 5 * time.Millisecond)
+        timing.Start("cache")()
+
+        return "ok", nil
+    })
+
+    return m
+}
+
+var responseTimeRe = regexp.MustCompile(`^[0-9]+\.[0-9]{3}ms$`)
+
+func TestTimingHeaders(t *testing.T) {
+    h := (&Config{Timing: true}).Wrap(newTimingMux())
+    w := serveJson(h, `{"id": 1, "method": "db"}`)
+
+    names, durs := timingPhases(w.Header().Get("Server-Timing"))
+
+    // Phases in the order they started, the handler ending after its own
+    want := []string{PhaseDecode, "db", "cache", PhaseHandler, PhaseEncode, "app"}
+    if !equalStrings(names, want) {
+        t.Errorf("Server-Timing = %q, want the phases %v", w.Header().Get("Server-Timing"), want)
+    }
+
+    // Phases recorded twice are summed
+    if durs["db"] != "10.000" {
+        t.Errorf("db;dur=%s, want 10.000", durs["db"])
+    }
+
+    if !responseTimeRe.MatchString(w.Header().Get("X-Response-Time")) {
+        t.Errorf("X-Response-Time = %q", w.Header().Get("X-Response-Time"))
+    }
+
+    // Notifications are timed too
+    w = serveJson(h, `{"method": "db"}`)
+    if w.Code != http.StatusNoContent || w.Header().Get("Server-Timing") == "" || w.Header().Get("X-Response-Time") == "" {
+        t.Errorf("status = %d, header = %v, want 204 with timing", w.Code, w.Header())
+    }
+}
+
+func TestTimingHandler(t *testing.T) {
+    var timing *Timing
+
+    h := (&Config{Timing: true}).Wrap(Handler(func(ctx context.Context, req *Request) (interface{}, error) {
+        timing = TimingFromContext(ctx)
+        defer timing.Start("db")()
+        return "ok", nil
+    }))
+
+    w := serveJson(h, `{"id": 1, "method": "any"}`)
+
+    if names, _ := timingPhases(w.Header().Get("Server-Timing")); timing == nil || !equalStrings(names, []string{PhaseDecode, "db", PhaseHandler, PhaseEncode, "app"}) {
+        t.Errorf("Server-Timing = %q", w.Header().Get("Server-Timing"))
+    }
+}
+
+func TestTimingDisabled(t *testing.T) {
+    var timing *Timing
+
+    m := NewMux()
+    m.Handle("db", func(ctx context.Context, req *Request) (interface{}, error) {
+        timing = TimingFromContext(ctx)
+
+        // A nil Timing records nothing
+        timing.Add("db", time.Millisecond)
+        timing.Start("db")()
+
+        return "ok", nil
+    })
+
+    for _, h := range []http.Handler{m, (&Config{}).Wrap(m)} {
+        w := serveJson(h, `{"id": 1, "method": "db"}`)
+
+        if timing != nil || w.Header().Get("Server-Timing") != "" || w.Header().Get("X-Response-Time") != "" {
+            t.Errorf("timing = %v, header = %v, want no timing", timing, w.Header())
+        }
+    }
+}
+
+func TestTimingHeader(t *testing.T) {
+    var timing *Timing
+
+    if header := timing.header(1500 * time.Microsecond); header != "app;dur=1.500" {
+        t.Errorf("header = %q, want the app phase only", header)
+    }
+
+    timing = &Timing{}
+    timing.Add("db", 250 * time.Microsecond)
+    timing.Add(PhaseEncode, time.Second)
+
+    if header := timing.header(2 * time.Second); header != "db;dur=0.250, encode;dur=1000.000, app;dur=2000.000" {
+        t.Errorf("header = %q", header)
+    }
+}
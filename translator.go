@@ -0,0 +1,135 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ *
+ * Message :: text with "{<ARG>}" placeholders, e.g. "should be at least {min} chars long"
+ */
+
+package sdtp
+
+import (
+    "fmt"
+    "strings"
+    "net/http"
+)
+
+// Translator provides the messages of the error objects, by translation key
+// as "standard-errors.ParseError" or "parameter-errors.TooLow".
+//
+// The built-in validators answer "validation-errors" keys, as
+// "validation-errors.StringTooShort" with the args {field} and {min}, listed
+// with their English messages in englishMessages. A translator returning ""
+// or the key itself for them gets the "parameter-errors" key of the error
+// code asked instead, with the same args.
+type Translator interface {
+    // Lang returns the language to answer r in.
+    Lang(r *http.Request) string
+
+    // T returns the message of key in lang, with its placeholders replaced
+    // by args.
+    T(lang string, key string, args map[string]interface{}) string
+}
+
+// DefaultTranslator answers in English whatever the language of the request.
+// Unknown keys are returned as is.
+var DefaultTranslator Translator = englishTranslator{}
+
+var englishMessages = map[string]string{
+    "standard-errors.ParseError":     "Parse error",
+    "standard-errors.InvalidRequest": "Invalid request",
+    "standard-errors.MethodNotFound": "Method not found",
+    "standard-errors.InvalidParams":  "Invalid params",
+    "standard-errors.InternalError":  "Internal error",
+
+    "security-errors.Unauthorized": "Unauthorized",
+    "security-errors.Forbidden":    "Forbidden",
+
+    "resource-errors.NotFound":      "Not found",
+    "resource-errors.NotAcceptable": "Not acceptable",
+
+    "process-errors.Conflict":            "Conflict",
+    "process-errors.UnprocessableEntity": "Unprocessable entity",
+
+    "parameter-errors.Required":      "Required",
+    "parameter-errors.TooLow":        "Too low",
+    "parameter-errors.LimitExceeded": "Limit exceeded",
+    "parameter-errors.Rejected":      "Rejected",
+
+    "validation-errors.Required":       "is required",
+    "validation-errors.StringTooShort": "must be at least {min} characters",
+    "validation-errors.StringTooLong":  "must be at most {max} characters",
+    "validation-errors.NumberTooLow":   "must be at least {min}",
+    "validation-errors.NumberTooHigh":  "must be at most {max}",
+    "validation-errors.Email":          "must be a valid email address",
+    "validation-errors.Date":           "must be a valid date",
+    "validation-errors.Username":       "must be a valid username",
+    "validation-errors.Type":           "must be a {type}",
+    "validation-errors.EqField":        "must be equal to {other}",
+    "validation-errors.NeField":        "must differ from {other}",
+    "validation-errors.GtField":        "must be greater than {other}",
+    "validation-errors.GteField":       "must be greater than or equal to {other}",
+    "validation-errors.LtField":        "must be less than {other}",
+    "validation-errors.LteField":       "must be less than or equal to {other}",
+    "validation-errors.AfterField":     "must be after {other}",
+    "validation-errors.NotBeforeField": "must not be before {other}",
+    "validation-errors.BeforeField":    "must be before {other}",
+    "validation-errors.NotAfterField":  "must not be after {other}",
+    "validation-errors.RequiredIf":     "is required when {other} is {value}",
+}
+
+type englishTranslator struct{}
+
+func (englishTranslator) Lang(r *http.Request) string {
+    return "en"
+}
+
+func (englishTranslator) T(lang string, key string, args map[string]interface{}) string {
+    message, ok := englishMessages[key]
+    if !ok {
+        message = key
+    }
+
+    return Interpolate(message, args)
+}
+
+// Interpolate replaces the "{name}" placeholders of message by the matching
+// args. Placeholders without an arg are left as is.
+func Interpolate(message string, args map[string]interface{}) string {
+    if len(args) == 0 || !strings.Contains(message, "{") {
+        return message
+    }
+
+    pairs := make([]string, 0, 2 * len(args))
+    for name, value := range args {
+        pairs = append(pairs, "{" + name + "}", fmt.Sprint(value))
+    }
+
+    return strings.NewReplacer(pairs...).Replace(message)
+}
+
+// MessageError is an error whose message is translated when it is answered,
+// as the errors returned by the built-in validators.
+type MessageError struct {
+    Key  string
+    Args map[string]interface{}
+}
+
+func NewMessageError(key string, args map[string]interface{}) *MessageError {
+    return &MessageError{Key: key, Args: args}
+}
+
+// Error returns the message in English.
+func (e *MessageError) Error() string {
+    return DefaultTranslator.T("en", e.Key, e.Args)
+}
+
+// Translator and language a response is written with.
+type locale struct {
+    tr   Translator
+    lang string
+}
+
+// Returns the message of key in the language of the locale.
+func (l locale) t(key string, args map[string]interface{}) string {
+    return l.tr.T(l.lang, key, args)
+}
@@ -0,0 +1,199 @@
+package sdtp
+
+import (
+    "time"
+    "testing"
+    "net/http"
+    "net/http/httptest"
+)
+
+func TestInterpolate(t *testing.T) {
+    tests := []struct {
+        message string
+        args    map[string]interface{}
+        want    string
+    }{
+        {"must be at least {min}", map[string]interface{}{"min": 3}, "must be at least 3"},
+        {"{field} and {field}", map[string]interface{}{"field": "name"}, "name and name"},
+        {"{a}{b}", map[string]interface{}{"a": 1.5, "b": true}, "1.5true"},
+        // Placeholders without an arg are left as is
+        {"at least {min}", map[string]interface{}{"max": 3}, "at least {min}"},
+        {"at least {min}", nil, "at least {min}"},
+        {"{ min }", map[string]interface{}{"min": 3}, "{ min }"},
+        {"no placeholder", map[string]interface{}{"min": 3}, "no placeholder"},
+        {"", map[string]interface{}{"min": 3}, ""},
+    }
+
+    for _, test := range tests {
+        if got := Interpolate(test.message, test.args); got != test.want {
+            t.Errorf("Interpolate(%q, %v) = %q, want %q", test.message, test.args, got, test.want)
+        }
+    }
+}
+
+func TestDefaultTranslator(t *testing.T) {
+    r := httptest.NewRequest("POST", "/", nil)
+    r.Header.Set("Accept-Language", "pt-BR")
+
+    if lang := DefaultTranslator.Lang(r); lang != "en" {
+        t.Errorf("Lang = %q, want en", lang)
+    }
+
+    tests := []struct {
+        key  string
+        args map[string]interface{}
+        want string
+    }{
+        {"standard-errors.ParseError", nil, "Parse error"},
+        {"validation-errors.StringTooShort", map[string]interface{}{"min": 3}, "must be at least 3 characters"},
+        // Unknown keys are returned as is
+        {"custom.Key", nil, "custom.Key"},
+        {"custom {x}", map[string]interface{}{"x": 1}, "custom 1"},
+    }
+
+    for _, test := range tests {
+        if got := DefaultTranslator.T("pt", test.key, test.args); got != test.want {
+            t.Errorf("T(%q) = %q, want %q", test.key, got, test.want)
+        }
+    }
+
+    // Every error code has its message
+    codes := []int{ParseError, InvalidRequest, MethodNotFound, InvalidParams, InternalError, Unauthorized, Forbidden, NotFound, NotAcceptable, Conflict, UnprocessableEntity}
+    for _, code := range codes {
+        if _, ok := englishMessages[errKey(code)]; !ok {
+            t.Errorf("no message for the code %d", code)
+        }
+    }
+
+    for _, code := range []int{Required, TooLow, LimitExceeded, Rejected} {
+        if _, ok := englishMessages[paramErrKey(code)]; !ok {
+            t.Errorf("no message for the parameter error %d", code)
+        }
+    }
+}
+
+func TestMessageError(t *testing.T) {
+    err := NewMessageError("validation-errors.NumberTooHigh", map[string]interface{}{"max": 10})
+
+    if err.Error() != "must be at most 10" {
+        t.Errorf("Error() = %q", err.Error())
+    }
+}
+
+// Answers the language and the key of every message.
+type langTranslator struct{}
+
+func (langTranslator) Lang(r *http.Request) string {
+    return "pt"
+}
+
+func (langTranslator) T(lang string, key string, args map[string]interface{}) string {
+    return lang + ":" + key
+}
+
+func TestTranslatorHttp(t *testing.T) {
+    c := &Config{Translator: langTranslator{}}
+
+    tests := []struct {
+        err      error
+        key      string
+        data_key string
+    }{
+        {NewNotFound(), "resource-errors.NotFound", ""},
+        {NewSingleInvalidParams(Required, "param:name"), "standard-errors.InvalidParams", "parameter-errors.Required"},
+        {NewSingleConflict("field:email"), "process-errors.Conflict", "parameter-errors.Rejected"},
+    }
+
+    for _, test := range tests {
+        w := httptest.NewRecorder()
+        SendHttpError(test.err, time.Now(), w, WithConfig(newJsonRequest(""), c))
+
+        var response map[string]interface{}
+        decodeJson(t, w, &response)
+
+        err_d, _ := response["error"].(map[string]interface{})
+        if err_d["message"] != "pt:" + test.key {
+            t.Errorf("%v: error = %v, want the message of %s", test.err, err_d, test.key)
+        }
+
+        if test.data_key == "" {
+            continue
+        }
+
+        // Parameter errors are translated too
+        data, _ := err_d["data"].([]interface{})
+        if entry, _ := data[0].(map[string]interface{}); entry["message"] != "pt:" + test.data_key {
+            t.Errorf("%v: entry = %v, want the message of %s", test.err, entry, test.data_key)
+        }
+    }
+
+    // Standard errors sent directly
+    w := httptest.NewRecorder()
+    SendHttpNotFound(time.Now(), w, WithConfig(newJsonRequest(""), c))
+
+    var response map[string]interface{}
+    if decodeJson(t, w, &response); response["error"].(map[string]interface{})["message"] != "pt:resource-errors.NotFound" {
+        t.Errorf("response = %v, want the translated message", response)
+    }
+
+    // Messages set by the handler are kept
+    w = httptest.NewRecorder()
+    SendHttpError(NewConflict("taken"), time.Now(), w, WithConfig(newJsonRequest(""), c))
+
+    if decodeJson(t, w, &response); response["error"].(map[string]interface{})["message"] != "taken" {
+        t.Errorf("response = %v, want the message kept", response)
+    }
+}
+
+func TestTranslatorMux(t *testing.T) {
+    h := (&Config{Translator: langTranslator{}}).Wrap(newTestMux())
+
+    tests := []struct {
+        body string
+        want string
+    }{
+        {`{"id": 1, "method": "nosuch"}`, "pt:standard-errors.MethodNotFound"},
+        {`{"id": 1,`, "pt:standard-errors.ParseError"},
+        {`[{"id": 1}]`, "pt:standard-errors.InvalidRequest"},
+    }
+
+    for _, test := range tests {
+        var response interface{}
+        decodeJson(t, serveJson(h, test.body), &response)
+
+        if batch, ok := response.([]interface{}); ok {
+            response = batch[0]
+        }
+
+        err_d, _ := response.(map[string]interface{})["error"].(map[string]interface{})
+        if err_d["message"] != test.want {
+            t.Errorf("%s: error = %v, want %s", test.body, err_d, test.want)
+        }
+    }
+}
+
+func TestTranslatorWs(t *testing.T) {
+    conn := dialWs(t, (&Config{Translator: langTranslator{}}).Wrap(NewWsHandler(newTestMux())))
+
+    tests := []struct {
+        message string
+        want    string
+    }{
+        {`{"id": 1, "method": "nosuch"}`, "pt:standard-errors.MethodNotFound"},
+        {`{"id": 2, "method": "fail"}`, "pt:resource-errors.NotFound"},
+        {`{"id": 3,`, "pt:standard-errors.ParseError"},
+        {`{"id": 4, "method": "panic"}`, "pt:standard-errors.InternalError"},
+    }
+
+    for _, test := range tests {
+        writeWs(t, conn, test.message)
+
+        var response map[string]interface{}
+        readWs(t, conn, &response)
+
+        err_d, _ := response["error"].(map[string]interface{})
+        if err_d["message"] != test.want {
+            t.Errorf("%s: error = %v, want %s", test.message, err_d, test.want)
+        }
+    }
+}
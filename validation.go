@@ -9,13 +9,17 @@ package sdtp
 
 import (
     "fmt"
+    "sort"
+    "sync"
     "time"
+    "errors"
     "reflect"
     "regexp"
+    "strconv"
     "strings"
     "net/http"
-    "github.com/iurybraun/go-cfg_ini"
-    "github.com/iurybraun/i18n_ini"
+    "unicode/utf8"
+    "database/sql/driver"
 )
 
 // Name of the struct tag used in examples.
@@ -28,6 +32,82 @@ var mailRe = regexp.MustCompile(`\A[\w+\-.]+@[a-z\d\-]+(\.[a-z]+)*\.[a-z]+\z`)
 //var usernameRe = regexp.MustCompile(`^[a-zA-Z0-9]([.]|[a-zA-Z0-9]){6,20}$`)
 var usernameRe = regexp.MustCompile(`^[a-zA-Z0-9]+(?:[.\-_]?[a-zA-Z0-9])*$`)
 
+// Returns the error of a failed validation. Its message is the translation
+// of "validation-errors.<name>" with args, done by ValidateStructFields which
+// adds the "field" arg. The args are answered in the error data too.
+func validationError(name string, args map[string]interface{}) error {
+    return NewMessageError("validation-errors." + name, args)
+}
+
+// Returns the error of a value whose type cannot be validated as kind.
+func typeError(kind string) (bool, int, error) {
+    return false, Rejected, validationError("Type", map[string]interface{}{"type": kind})
+}
+
+// Returns the value behind pointers and sql.Null* style types, nil when
+// there is none.
+func indirectValue(val interface{}) interface{} {
+    for val != nil {
+        rv := reflect.ValueOf(val)
+        
+        switch {
+            case rv.Kind() == reflect.Ptr:
+                if rv.IsNil() {
+                    return nil
+                }
+                val = rv.Elem().Interface()
+            case rv.Type().Implements(valuerType):
+                v, err := val.(driver.Valuer).Value()
+                if err != nil {
+                    return val
+                }
+                return v
+            default:
+                return val
+        }
+    }
+    
+    return nil
+}
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// Returns the string held by val, "" when it holds none.
+func stringOf(val interface{}) (string, bool) {
+    val = indirectValue(val)
+    if val == nil {
+        return "", true
+    }
+    
+    if rv := reflect.ValueOf(val); rv.Kind() == reflect.String {
+        return rv.String(), true
+    }
+    
+    return "", false
+}
+
+// Returns the integer held by val, 0 when it holds none.
+func intOf(val interface{}) (int, bool) {
+    val = indirectValue(val)
+    if val == nil {
+        return 0, true
+    }
+    
+    return toInt(val)
+}
+
+// Returns the time held by val, the zero time when it holds none.
+func timeOf(val interface{}) (time.Time, bool) {
+    val = indirectValue(val)
+    if val == nil {
+        return time.Time{}, true
+    }
+    
+    t, ok := val.(time.Time)
+    
+    return t, ok
+}
+
 // Generic data validator.
 type Validator interface {
     // Validate method performs validation and returns result and optional error.
@@ -42,51 +122,85 @@ func (v DefaultValidator) Validate(val interface{}, lang string) (bool, int, err
     return true, 0, nil
 }
 
-// StringValidator validates string presence and/or its length.
+// RequiredValidator checks that a value is given and is not the zero value
+// of its type.
+type RequiredValidator struct {
+}
+
+func (v RequiredValidator) Validate(val interface{}, lang string) (bool, int, error) {
+    val = indirectValue(val)
+    
+    if val == nil || reflect.ValueOf(val).IsZero() {
+        return false, Required, validationError("Required", nil)
+    }
+    
+    return true, 0, nil
+}
+
+// ChainValidator runs several validators in order, stopping at the first
+// failure.
+type ChainValidator []Validator
+
+func (v ChainValidator) Validate(val interface{}, lang string) (bool, int, error) {
+    for _, validator := range v {
+        if valid, code_error, err := validator.Validate(val, lang); !valid {
+            return valid, code_error, err
+        }
+    }
+    
+    return true, 0, nil
+}
+
+// StringValidator validates string presence and/or its length. Min and Max
+// count characters (runes), not bytes, as the messages answered say: "é"
+// is 1 long, where it was 2 before the messages took args.
 type StringValidator struct {
     Min int
     Max int
 }
 
 func (v StringValidator) Validate(val interface{}, lang string) (bool, int, error) {
-    l := len(val.(string))
+    str, ok := stringOf(val)
+    if !ok {
+        return typeError("string")
+    }
+    
+    l := utf8.RuneCountInString(str)
     
     if l == 0 {
-        //return false, fmt.Errorf("cannot be blank")
-        return false, Required, fmt.Errorf(i18n_ini.LoadTr(lang, "parameter-errors.Required"))
+        return false, Required, validationError("Required", nil)
     }
     
     if l < v.Min {
-        //return false, fmt.Errorf("should be at least %v chars long", v.Min)
-        return false, TooLow, fmt.Errorf(i18n_ini.LoadTr(lang, "parameter-errors.TooLow"))
+        return false, TooLow, validationError("StringTooShort", map[string]interface{}{"min": v.Min, "length": l})
     }
     
     if v.Max >= v.Min && l > v.Max {
-        //return false, fmt.Errorf("should be less than %v chars long", v.Max)
-        return false, LimitExceeded, fmt.Errorf(i18n_ini.LoadTr(lang, "parameter-errors.LimitExceeded"))
+        return false, LimitExceeded, validationError("StringTooLong", map[string]interface{}{"max": v.Max, "length": l})
     }
     
     return true, 0, nil
 }
 
 // NumberValidator performs numerical value validation.
-// Its limited to int type for simplicity.
+// Its limited to integers for simplicity.
 type NumberValidator struct {
     Min int
     Max int
 }
 
 func (v NumberValidator) Validate(val interface{}, lang string) (bool, int, error) {
-    num := val.(int)
+    num, ok := intOf(val)
+    if !ok {
+        return typeError("number")
+    }
     
     if num < v.Min {
-        //return false, TooLow, fmt.Errorf("should be greater than %v", v.Min)
-        return false, TooLow, fmt.Errorf(i18n_ini.LoadTr(lang, "parameter-errors.TooLow"))
+        return false, TooLow, validationError("NumberTooLow", map[string]interface{}{"min": v.Min, "value": num})
     }
     
     if v.Max >= v.Min && num > v.Max {
-        //return false, LimitExceeded, fmt.Errorf("should be less than %v", v.Max)
-        return false, LimitExceeded, fmt.Errorf(i18n_ini.LoadTr(lang, "parameter-errors.LimitExceeded"))
+        return false, LimitExceeded, validationError("NumberTooHigh", map[string]interface{}{"max": v.Max, "value": num})
     }
     
     return true, 0, nil
@@ -98,10 +212,13 @@ type DateValidator struct {
 
 func (v DateValidator) Validate(val interface{}, lang string) (bool, int, error) {
     
-    date := val.(time.Time)
+    date, ok := timeOf(val)
+    if !ok {
+        return typeError("date")
+    }
     
     if date.IsZero() {
-        return false, Rejected, fmt.Errorf(i18n_ini.LoadTr(lang, "parameter-errors.Rejected"))
+        return false, Rejected, validationError("Date", nil)
     }
     
     return true, 0, nil
@@ -113,13 +230,20 @@ type EmailValidator struct {
 }
 
 func (v EmailValidator) Validate(val interface{}, lang string) (bool, int, error) {
-    if !mailRe.MatchString(val.(string)) {
-        return false, Rejected, fmt.Errorf(i18n_ini.LoadTr(lang, "parameter-errors.Rejected"))  //fmt.Errorf("is not a valid email address")
+    str, ok := stringOf(val)
+    if !ok {
+        return typeError("string")
+    }
+    
+    if !mailRe.MatchString(str) {
+        return false, Rejected, validationError("Email", nil)
     }
     
     return true, 0, nil
 }
 
+// UsernameValidator validates a username, its length counted in characters
+// (runes) as for StringValidator.
 type UsernameValidator struct {
     Min int
     Max int
@@ -127,93 +251,286 @@ type UsernameValidator struct {
 
 func (v UsernameValidator) Validate(val interface{}, lang string) (bool, int, error) {
     
-    l := len(val.(string))
+    str, ok := stringOf(val)
+    if !ok {
+        return typeError("string")
+    }
+    
+    l := utf8.RuneCountInString(str)
     
     if l == 0 {
-        return false, Required, fmt.Errorf(i18n_ini.LoadTr(lang, "parameter-errors.Required"))
+        return false, Required, validationError("Required", nil)
     }
     
     if l < v.Min {
-        return false, TooLow, fmt.Errorf(i18n_ini.LoadTr(lang, "parameter-errors.TooLow"))
+        return false, TooLow, validationError("StringTooShort", map[string]interface{}{"min": v.Min, "length": l})
     }
     
     if v.Max >= v.Min && l > v.Max {
-        return false, LimitExceeded, fmt.Errorf(i18n_ini.LoadTr(lang, "parameter-errors.LimitExceeded"))
+        return false, LimitExceeded, validationError("StringTooLong", map[string]interface{}{"max": v.Max, "length": l})
     }
     
     
-    if usernameRe.FindString(val.(string)) == "" {
-        return false, Rejected, fmt.Errorf(i18n_ini.LoadTr(lang, "parameter-errors.Rejected"))
+    if usernameRe.FindString(str) == "" {
+        return false, Rejected, validationError("Username", nil)
     }
     
     return true, 0, nil
 }
 
-// Returns validator struct corresponding to validation type
-func getValidatorFromTag(tag string) Validator {
-    args := strings.Split(tag, ",")
+// Performs actual data validation using validator definitions on the struct.
+// Nested structs, pointers, slices, arrays and maps are walked too, their
+// fields located as "field:address.city" or "field:items[2].sku". Fields
+// with a malformed tag get an entry of code InternalError.
+func ValidateStructFields(s interface{}, r *http.Request) E1 {  //[]error {
+    err_map, _ := validateStruct(s, r)
+    
+    return err_map
+}
+
+// ValidateStruct validates s as ValidateStructFields, returning an
+// InvalidParams error with the entries of the fields failing validation. A
+// malformed tag is returned as a *TagError, answered as an InternalError.
+func ValidateStruct(s interface{}, r *http.Request) error {
+    err_map, err := validateStruct(s, r)
+    if err != nil {
+        return err
+    }
     
-    switch args[0] {
-        case "number":
-            validator := NumberValidator{}
-            fmt.Sscanf(strings.Join(args[1:], ","), "min=%d,max=%d", &validator.Min, &validator.Max)
-            return validator
-        case "string":
-            validator := StringValidator{}
-            fmt.Sscanf(strings.Join(args[1:], ","), "min=%d,max=%d", &validator.Min, &validator.Max)
-            return validator
-        case "email":
-            return EmailValidator{}
-        case "date":
-            return DateValidator{}
-        case "username":
-            validator := UsernameValidator{}
-            fmt.Sscanf(strings.Join(args[1:], ","), "min=%d,max=%d", &validator.Min, &validator.Max)
-            return validator
+    if err_map != nil {
+        return NewInvalidParams(err_map)
     }
     
-    return DefaultValidator{}
+    return nil
 }
 
-// Performs actual data validation using validator definitions on the struct
-func ValidateStructFields(s interface{}, r *http.Request) E1 {  //[]error {
-    var lang = cfg_ini.GetLang(r)
+// Returns the entries of the fields failing validation and the first tag
+// error met.
+func validateStruct(s interface{}, r *http.Request) (E1, error) {
+    var lang = langOf(r)
     
-    err_map := NewErrorData()
-    //errs := []error{}
+    defer timingOf(r).Start(PhaseValidate)()
+    
+    sv := &structValidator{lang: lang, visited: make(map[visit]bool)}
     
     // ValueOf returns a Value representing the run-time data
-    v := reflect.ValueOf(s)
+    sv.walk(reflect.ValueOf(s), "")
+    
+    if len(sv.err_map) > 0 {
+        return sv.err_map, sv.err  //errs
+    } else {
+        return nil, sv.err
+    }
+}
+
+// Walks a value, validating the tagged fields of every struct reached.
+type structValidator struct {
+    lang    locale
+    err_map E1
+    
+    // First tag error met
+    err error
+    
+    // Pointers already walked, so that cyclic values end
+    visited map[visit]bool
+}
+
+type visit struct {
+    ptr uintptr
+    typ reflect.Type
+}
+
+func (sv *structValidator) walk(v reflect.Value, path string) {
+    switch v.Kind() {
+        case reflect.Ptr:
+            if v.IsNil() {
+                return
+            }
+            
+            key := visit{v.Pointer(), v.Type()}
+            if sv.visited[key] {
+                return
+            }
+            sv.visited[key] = true
+            
+            sv.walk(v.Elem(), path)
+        case reflect.Interface:
+            if !v.IsNil() {
+                sv.walk(v.Elem(), path)
+            }
+        case reflect.Struct:
+            sv.walkStruct(v, path)
+        case reflect.Slice, reflect.Array:
+            if !mayHoldStruct(v.Type()) {
+                return
+            }
+            
+            for i := 0; i < v.Len(); i++ {
+                sv.walk(v.Index(i), path + "[" + strconv.Itoa(i) + "]")
+            }
+        case reflect.Map:
+            if !mayHoldStruct(v.Type()) {
+                return
+            }
+            
+            keys := v.MapKeys()
+            sort.Slice(keys, func(i, j int) bool {
+                return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+            })
+            
+            for _, key := range keys {
+                sv.walk(v.MapIndex(key), path + "[" + fmt.Sprint(key.Interface()) + "]")
+            }
+    }
+}
+
+// Element types of the slices, arrays and maps checked so far, by type.
+var holdsStruct sync.Map
+
+// Returns false when the elements of the slice, array or map type t cannot
+// reach a struct, as for []byte, so that they are not walked one by one.
+func mayHoldStruct(t reflect.Type) bool {
+    if holds, ok := holdsStruct.Load(t); ok {
+        return holds.(bool)
+    }
+    
+    holds := false
+    seen := make(map[reflect.Type]bool)
+    
+    // Cyclic types as "type T []T" end once seen
+    for elem := t.Elem(); !seen[elem]; elem = elem.Elem() {
+        seen[elem] = true
+        
+        kind := elem.Kind()
+        if kind == reflect.Struct || kind == reflect.Interface || kind == reflect.Ptr {
+            holds = true
+            break
+        }
+        
+        if kind != reflect.Slice && kind != reflect.Array && kind != reflect.Map {
+            break
+        }
+    }
+    
+    holdsStruct.Store(t, holds)
+    
+    return holds
+}
+
+func (sv *structValidator) walkStruct(v reflect.Value, path string) {
+    t := v.Type()
     
     for i := 0; i < v.NumField(); i++ {
+        field := t.Field(i)
+        
+        // Unexported fields cannot be read
+        if field.PkgPath != "" && !field.Anonymous {
+            continue
+        }
+        
         // Get the field tag value
-        tag := v.Type().Field(i).Tag.Get(tagName)
-
-        // Skip if tag is not defined or ignored
-        if tag == "" || tag == "-" {
+        tag := field.Tag.Get(tagName)
+        
+        // Skip if tag is ignored
+        if tag == "-" {
             continue
         }
+        
+        // Embedded structs share the location of their parent
+        name := path
+        if !field.Anonymous {
+            name = joinPath(path, strings.ToLower(field.Name))
+        }
+        
+        if tag != "" && v.Field(i).CanInterface() {
+            // Get a validator that corresponds to a tag
+            validator, err := validatorOf(tag)
+            if err != nil {
+                sv.tagError(&TagError{Type: t, Field: field.Name, Err: err}, name)
+                sv.walk(v.Field(i), name)
+                continue
+            }
+            
+            // Perform validation, with the struct holding the field
+            valid, code_error, err := validateContext(validator, &ValidationContext{
+                Value: v.Field(i).Interface(),
+                Lang: sv.lang.lang,
+                Location: name,
+                parent: v,
+                path: path,
+            })
+            
+            // Append error to results
+            var tag_err *TagError
+            if !valid && errors.As(err, &tag_err) {
+                if tag_err.Field == "" {
+                    tag_err.Field = field.Name
+                }
+                sv.tagError(tag_err, name)
+            } else if !valid && err != nil {
+                sv.err_map = append(sv.err_map, fieldEntry(code_error, name, err, sv.lang))
+            }
+        }
+        
+        sv.walk(v.Field(i), name)
+    }
+}
 
-        // Get a validator that corresponds to a tag
-        validator := getValidatorFromTag(tag)
-
-        // Perform validation
-        valid, code_error, err := validator.Validate(v.Field(i).Interface(), lang)
+// Reports a tag error with an InternalError entry for the field, keeping the
+// details for the application only.
+func (sv *structValidator) tagError(err *TagError, field string) {
+    if sv.err == nil {
+        sv.err = err
+    }
+    
+    sv.err_map = append(sv.err_map, map[string]interface{}{
+        "code": InternalError,
+        "location": "field:" + field,
+        "message": sv.lang.t(errKey(InternalError), nil),
+    })
+}
 
-        // Append error to results
-        if !valid && err != nil {
-            //errs = append(errs, fmt.Errorf("%s %s", v.Type().Field(i).Name, err.Error()))
-            err_map = append(err_map, map[string]interface{}{
-                            "code": code_error,
-                            "location": "field:"+strings.ToLower(v.Type().Field(i).Name),
-                            "message": err.Error(),  //i18n_ini.LoadTr(lang, "parameter-errors.Required"),
-                        })
-        }
+// Returns the location of a field of the value at path.
+func joinPath(path string, name string) string {
+    if path == "" {
+        return name
     }
     
-    if len(err_map) > 0 {
-        return err_map  //errs
-    } else {
-        return nil
+    return path + "." + name
+}
+
+// Builds the error data entry of a field that failed validation. The message
+// of a *MessageError is translated with the "field" arg added, and its args
+// are answered in the entry. Translators lacking its key, as INI files
+// written before the "validation-errors" keys, give the message of the
+// "parameter-errors" key of the code instead.
+func fieldEntry(parameter_error int, field string, err error, lang locale) map[string]interface{} {
+    entry := map[string]interface{}{
+        "code": parameter_error,
+        "location": "field:" + field,
     }
+
+    var e *MessageError
+    if !errors.As(err, &e) {
+        entry["message"] = err.Error()
+        return entry
+    }
+
+    args := make(map[string]interface{}, len(e.Args) + 1)
+    for name, value := range e.Args {
+        args[name] = value
+    }
+    args["field"] = field
+
+    message := lang.t(e.Key, args)
+    if message == "" || message == e.Key {
+        if key := paramErrKey(parameter_error); key != "" {
+            message = lang.t(key, args)
+        }
+    }
+
+    entry["message"] = message
+    entry["args"] = args
+
+    return entry
 }
@@ -0,0 +1,355 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ *
+ * Cross-field rules, naming a sibling field of the same struct:
+ *  eqfield=<FIELD>, nefield=<FIELD>
+ *  gtfield=<FIELD>, gtefield=<FIELD>, ltfield=<FIELD>, ltefield=<FIELD>, numbers, strings and dates
+ *  required_if=<FIELD>:<VALUE>
+ */
+
+package sdtp
+
+import (
+    "fmt"
+    "time"
+    "reflect"
+    "strings"
+    "encoding/json"
+)
+
+// ValidationContext is the field being validated, along with the struct
+// holding it.
+type ValidationContext struct {
+    // Value of the field
+    Value interface{}
+
+    // Language of the messages and location of the field, as "items[2].sku"
+    Lang     string
+    Location string
+
+    parent reflect.Value
+    path   string
+}
+
+// Field returns the value of a sibling field, by its Go name or its
+// location name. It returns false when the struct has no such field, or
+// when the field is promoted through a nil embedded pointer.
+func (ctx *ValidationContext) Field(name string) (interface{}, bool) {
+    if !ctx.parent.IsValid() {
+        return nil, false
+    }
+
+    t := ctx.parent.Type()
+
+    field, ok := t.FieldByName(name)
+    if !ok {
+        field, ok = t.FieldByNameFunc(func(field_name string) bool {
+            return strings.EqualFold(field_name, name)
+        })
+    }
+
+    if !ok {
+        return nil, false
+    }
+
+    f, err := ctx.parent.FieldByIndexErr(field.Index)
+    if err != nil || !f.CanInterface() {
+        return nil, false
+    }
+
+    return f.Interface(), true
+}
+
+// Returns the location of a sibling field.
+func (ctx *ValidationContext) location(name string) string {
+    return joinPath(ctx.path, strings.ToLower(name))
+}
+
+// ContextValidator is implemented by validators needing the struct holding
+// the field, as the cross-field ones. ValidateStructFields calls
+// ValidateContext instead of Validate.
+type ContextValidator interface {
+    Validator
+
+    ValidateContext(ctx *ValidationContext) (bool, int, error)
+}
+
+// Runs a validator with the context of the field.
+func validateContext(validator Validator, ctx *ValidationContext) (bool, int, error) {
+    if cv, ok := validator.(ContextValidator); ok {
+        return cv.ValidateContext(ctx)
+    }
+
+    return validator.Validate(ctx.Value, ctx.Lang)
+}
+
+func (v ChainValidator) ValidateContext(ctx *ValidationContext) (bool, int, error) {
+    for _, validator := range v {
+        if valid, code_error, err := validateContext(validator, ctx); !valid {
+            return valid, code_error, err
+        }
+    }
+
+    return true, 0, nil
+}
+
+// Implemented by validators referencing sibling fields, checked by
+// RegisterStruct.
+type fieldReferrer interface {
+    siblingFields() []string
+}
+
+func (v ChainValidator) siblingFields() []string {
+    var fields []string
+
+    for _, validator := range v {
+        if fr, ok := validator.(fieldReferrer); ok {
+            fields = append(fields, fr.siblingFields()...)
+        }
+    }
+
+    return fields
+}
+
+// Returns the value of a sibling field, nil when it is promoted through a
+// nil embedded pointer, or a *TagError when the struct has none, its Field
+// being set by ValidateStructFields.
+func siblingOf(ctx *ValidationContext, name string) (interface{}, error) {
+    if val, ok := ctx.Field(name); ok {
+        return val, nil
+    }
+
+    var t reflect.Type
+    if ctx.parent.IsValid() {
+        t = ctx.parent.Type()
+
+        if hasField(t, name) {
+            return nil, nil
+        }
+    }
+
+    return nil, &TagError{Type: t, Err: fmt.Errorf("unknown field %s", name)}
+}
+
+// FieldValidator compares a field with a sibling field. Op is one of "eq",
+// "ne", "gt", "gte", "lt" and "lte". Fields without value are left to the
+// required rule.
+type FieldValidator struct {
+    Field string
+    Op    string
+}
+
+// Validate passes, the sibling field is only known to ValidateContext.
+func (v FieldValidator) Validate(val interface{}, lang string) (bool, int, error) {
+    return true, 0, nil
+}
+
+func (v FieldValidator) ValidateContext(ctx *ValidationContext) (bool, int, error) {
+    sibling, err := siblingOf(ctx, v.Field)
+    if err != nil {
+        return false, InternalError, err
+    }
+
+    val := indirectValue(ctx.Value)
+    other := indirectValue(sibling)
+
+    if val == nil || other == nil {
+        return true, 0, nil
+    }
+
+    args := map[string]interface{}{"other": ctx.location(v.Field)}
+
+    c, ok := compareValues(val, other)
+
+    switch v.Op {
+        case "eq", "ne":
+            equal := reflect.DeepEqual(val, other)
+            if ok {
+                equal = c == 0
+            }
+
+            if v.Op == "eq" && !equal {
+                return false, Rejected, validationError("EqField", args)
+            }
+            if v.Op == "ne" && equal {
+                return false, Rejected, validationError("NeField", args)
+            }
+            return true, 0, nil
+    }
+
+    if !ok {
+        return typeError(kindOf(other))
+    }
+
+    _, is_date := val.(time.Time)
+
+    switch {
+        case v.Op == "gt" && c <= 0:
+            return false, TooLow, validationError(orderKey("GtField", "AfterField", is_date), args)
+        case v.Op == "gte" && c < 0:
+            return false, TooLow, validationError(orderKey("GteField", "NotBeforeField", is_date), args)
+        case v.Op == "lt" && c >= 0:
+            return false, LimitExceeded, validationError(orderKey("LtField", "BeforeField", is_date), args)
+        case v.Op == "lte" && c > 0:
+            return false, LimitExceeded, validationError(orderKey("LteField", "NotAfterField", is_date), args)
+    }
+
+    return true, 0, nil
+}
+
+func (v FieldValidator) siblingFields() []string {
+    return []string{v.Field}
+}
+
+func orderKey(key string, date_key string, is_date bool) string {
+    if is_date {
+        return date_key
+    }
+
+    return key
+}
+
+// Compares two dates, numbers or strings. Returns false when they cannot be
+// compared.
+func compareValues(a interface{}, b interface{}) (int, bool) {
+    if ta, ok := a.(time.Time); ok {
+        tb, ok := b.(time.Time)
+        if !ok {
+            return 0, false
+        }
+
+        switch {
+            case ta.Before(tb):
+                return -1, true
+            case ta.After(tb):
+                return 1, true
+        }
+        return 0, true
+    }
+
+    if fa, ok := toFloat(a); ok {
+        fb, ok := toFloat(b)
+        if !ok {
+            return 0, false
+        }
+
+        switch {
+            case fa < fb:
+                return -1, true
+            case fa > fb:
+                return 1, true
+        }
+        return 0, true
+    }
+
+    sa, ok := stringOf(a)
+    if !ok {
+        return 0, false
+    }
+
+    sb, ok := stringOf(b)
+    if !ok {
+        return 0, false
+    }
+
+    return strings.Compare(sa, sb), true
+}
+
+// Converts a decoded number to float64.
+func toFloat(v interface{}) (float64, bool) {
+    if n, ok := v.(json.Number); ok {
+        f, err := n.Float64()
+        return f, err == nil
+    }
+
+    rv := reflect.ValueOf(v)
+
+    switch rv.Kind() {
+        case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+            return float64(rv.Int()), true
+        case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+            return float64(rv.Uint()), true
+        case reflect.Float32, reflect.Float64:
+            return rv.Float(), true
+    }
+
+    return 0, false
+}
+
+// Returns the kind of value expected to match v, for type errors.
+func kindOf(v interface{}) string {
+    if _, ok := v.(time.Time); ok {
+        return "date"
+    }
+
+    if _, ok := toFloat(v); ok {
+        return "number"
+    }
+
+    return "string"
+}
+
+// RequiredIfValidator requires the field when the sibling Field holds
+// Value, compared as text.
+type RequiredIfValidator struct {
+    Field string
+    Value string
+}
+
+// Validate passes, the sibling field is only known to ValidateContext.
+func (v RequiredIfValidator) Validate(val interface{}, lang string) (bool, int, error) {
+    return true, 0, nil
+}
+
+func (v RequiredIfValidator) ValidateContext(ctx *ValidationContext) (bool, int, error) {
+    sibling, err := siblingOf(ctx, v.Field)
+    if err != nil {
+        return false, InternalError, err
+    }
+
+    other := indirectValue(sibling)
+
+    if other == nil || fmt.Sprint(other) != v.Value {
+        return true, 0, nil
+    }
+
+    if valid, code_error, _ := (RequiredValidator{}).Validate(ctx.Value, ctx.Lang); !valid {
+        return false, code_error, validationError("RequiredIf", map[string]interface{}{
+            "other": ctx.location(v.Field),
+            "value": v.Value,
+        })
+    }
+
+    return true, 0, nil
+}
+
+func (v RequiredIfValidator) siblingFields() []string {
+    return []string{v.Field}
+}
+
+func init() {
+    for _, op := range []string{"eq", "ne", "gt", "gte", "lt", "lte"} {
+        op := op
+
+        RegisterValidator(op + "field", func(args map[string]string) (Validator, error) {
+            a := &ruleArgs{args: args}
+            validator := FieldValidator{Field: a.string("value"), Op: op}
+            if validator.Field == "" {
+                return nil, fmt.Errorf("missing field name")
+            }
+            return validator, a.done()
+        })
+    }
+
+    RegisterValidator("required_if", func(args map[string]string) (Validator, error) {
+        a := &ruleArgs{args: args}
+
+        field, value, ok := strings.Cut(a.string("value"), ":")
+        if !ok || field == "" {
+            return nil, fmt.Errorf("expected required_if=<FIELD>:<VALUE>")
+        }
+
+        return RequiredIfValidator{Field: field, Value: value}, a.done()
+    })
+}
@@ -0,0 +1,274 @@
+package sdtp
+
+import (
+    "time"
+    "errors"
+    "reflect"
+    "strconv"
+    "testing"
+    "encoding/json"
+    "net/http/httptest"
+)
+
+// Returns the entries of err_map as "<location> <code>", in order.
+func entriesOf(err_map E1) []string {
+    entries := make([]string, 0, len(err_map))
+
+    for _, entry := range err_map {
+        code, _ := entry["code"].(int)
+        location, _ := entry["location"].(string)
+
+        entries = append(entries, location + " " + strconv.Itoa(code))
+    }
+
+    return entries
+}
+
+func validateEntries(s interface{}) []string {
+    return entriesOf(ValidateStructFields(s, httptest.NewRequest("POST", "/", nil)))
+}
+
+type FieldBase struct {
+    Name string
+}
+
+type embeddedSibling struct {
+    *FieldBase
+    Other string `validate:"eqfield=Name"`
+}
+
+func TestFieldPromotedThroughNilPointer(t *testing.T) {
+    if err := RegisterStruct(embeddedSibling{}); err != nil {
+        t.Fatal(err)
+    }
+
+    // No value to compare with, left to the required rule
+    if entries := validateEntries(embeddedSibling{Other: "x"}); len(entries) != 0 {
+        t.Errorf("entries = %v, want none", entries)
+    }
+
+    entries := validateEntries(embeddedSibling{FieldBase: &FieldBase{Name: "y"}, Other: "x"})
+    if len(entries) != 1 || entries[0] != "field:other " + strconv.Itoa(Rejected) {
+        t.Errorf("entries = %v, want other rejected", entries)
+    }
+
+    ctx := &ValidationContext{}
+    if _, ok := ctx.Field("Name"); ok {
+        t.Error("Field of a context without struct is found")
+    }
+}
+
+type fieldRules struct {
+    A int `validate:"-"`
+    B int `validate:"-"`
+
+    Eq  int `validate:"eqfield=A"`
+    Ne  int `validate:"nefield=A"`
+    Gt  int `validate:"gtfield=A"`
+    Gte int `validate:"gtefield=A"`
+    Lt  int `validate:"ltfield=A"`
+    Lte int `validate:"ltefield=A"`
+}
+
+func TestFieldRulesOnNumbers(t *testing.T) {
+    rejected := strconv.Itoa(Rejected)
+    too_low := strconv.Itoa(TooLow)
+    exceeded := strconv.Itoa(LimitExceeded)
+
+    tests := []struct {
+        value int
+        want  []string
+    }{
+        // A is 5
+        {4, []string{"field:eq " + rejected, "field:gt " + too_low, "field:gte " + too_low}},
+        {5, []string{"field:ne " + rejected, "field:gt " + too_low, "field:lt " + exceeded}},
+        {6, []string{"field:eq " + rejected, "field:lt " + exceeded, "field:lte " + exceeded}},
+    }
+
+    for _, test := range tests {
+        v := test.value
+        s := fieldRules{A: 5, Eq: v, Ne: v, Gt: v, Gte: v, Lt: v, Lte: v}
+
+        if entries := validateEntries(s); !equalStrings(entries, test.want) {
+            t.Errorf("%d: entries = %v, want %v", v, entries, test.want)
+        }
+    }
+}
+
+type stringFields struct {
+    From string
+    To   string `validate:"gtfield=From"`
+}
+
+type dateFields struct {
+    Start time.Time
+    End   *time.Time `validate:"gtfield=Start"`
+    Until time.Time  `validate:"ltefield=Start"`
+}
+
+type mixedFields struct {
+    Name  string
+    Count int `validate:"gtfield=Name"`
+}
+
+func TestFieldRulesCompare(t *testing.T) {
+    day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+    before, after := day.Add(-time.Hour), day.Add(time.Hour)
+
+    tests := []struct {
+        s    interface{}
+        want []string
+    }{
+        {stringFields{From: "b", To: "c"}, nil},
+        {stringFields{From: "b", To: "a"}, []string{"field:to " + strconv.Itoa(TooLow)}},
+        {dateFields{Start: day, End: &after, Until: before}, nil},
+        {dateFields{Start: day, End: &before, Until: after}, []string{
+            "field:end " + strconv.Itoa(TooLow),
+            "field:until " + strconv.Itoa(LimitExceeded),
+        }},
+        // Nil fields are left to the required rule
+        {dateFields{Start: day, Until: day}, nil},
+        {mixedFields{Name: "x", Count: 1}, []string{"field:count " + strconv.Itoa(Rejected)}},
+    }
+
+    for _, test := range tests {
+        if entries := validateEntries(test.s); !equalStrings(entries, test.want) {
+            t.Errorf("%+v: entries = %v, want %v", test.s, entries, test.want)
+        }
+    }
+}
+
+func TestFieldRuleMessages(t *testing.T) {
+    day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+    before := day.Add(-time.Hour)
+
+    tests := []struct {
+        s       interface{}
+        message string
+    }{
+        {fieldRules{A: 5, Eq: 1, Ne: 1, Gt: 6, Gte: 6, Lt: 1, Lte: 1}, "must be equal to a"},
+        {dateFields{Start: day, End: &before}, "must be after start"},
+        {struct {
+            Start time.Time
+            End   time.Time `validate:"gtefield=Start"`
+        }{day, before}, "must not be before start"},
+        {struct {
+            Start time.Time
+            End   time.Time `validate:"ltfield=Start"`
+        }{before, day}, "must be before start"},
+        {dateFields{Start: before, Until: day}, "must not be after start"},
+        {mixedFields{Name: "x", Count: 1}, "must be a string"},
+    }
+
+    for _, test := range tests {
+        err_map := ValidateStructFields(test.s, httptest.NewRequest("POST", "/", nil))
+
+        if len(err_map) == 0 || err_map[0]["message"] != test.message {
+            t.Errorf("%+v: entries = %v, want the message %q", test.s, err_map, test.message)
+        }
+    }
+}
+
+type requiredIf struct {
+    Kind    string
+    Company string `validate:"required_if=Kind:business"`
+}
+
+func TestRequiredIf(t *testing.T) {
+    tests := []struct {
+        s    requiredIf
+        want []string
+    }{
+        {requiredIf{Kind: "person"}, nil},
+        {requiredIf{Kind: "business", Company: "Acme"}, nil},
+        {requiredIf{Kind: "business"}, []string{"field:company " + strconv.Itoa(Required)}},
+    }
+
+    for _, test := range tests {
+        if entries := validateEntries(test.s); !equalStrings(entries, test.want) {
+            t.Errorf("%+v: entries = %v, want %v", test.s, entries, test.want)
+        }
+    }
+
+    err_map := ValidateStructFields(requiredIf{Kind: "business"}, httptest.NewRequest("POST", "/", nil))
+    if message := err_map[0]["message"]; message != "is required when kind is business" {
+        t.Errorf("message = %q", message)
+    }
+}
+
+type nestedFields struct {
+    Items []stringFields
+}
+
+func TestFieldRuleLocatesSiblingInPath(t *testing.T) {
+    err_map := ValidateStructFields(nestedFields{Items: []stringFields{{From: "b", To: "c"}, {From: "b", To: "a"}}}, httptest.NewRequest("POST", "/", nil))
+
+    if len(err_map) != 1 || err_map[0]["location"] != "field:items[1].to" || err_map[0]["message"] != "must be greater than items[1].from" {
+        t.Errorf("entries = %v, want items[1].to compared with items[1].from", err_map)
+    }
+}
+
+type unknownSibling struct {
+    A int `validate:"eqfield=Missing"`
+    B int `validate:"required_if=Missing:1"`
+}
+
+func TestUnknownSibling(t *testing.T) {
+    r := httptest.NewRequest("POST", "/", nil)
+
+    want := []string{"field:a " + strconv.Itoa(InternalError), "field:b " + strconv.Itoa(InternalError)}
+    if entries := entriesOf(ValidateStructFields(unknownSibling{}, r)); !equalStrings(entries, want) {
+        t.Errorf("entries = %v, want %v", entries, want)
+    }
+
+    var tag_err *TagError
+    if err := ValidateStruct(unknownSibling{}, r); !errors.As(err, &tag_err) || tag_err.Field != "A" || tag_err.Type != reflect.TypeOf(unknownSibling{}) {
+        t.Errorf("err = %v, want a TagError of field A", err)
+    }
+
+    if err := RegisterStruct(unknownSibling{}); !errors.As(err, &tag_err) || tag_err.Field != "A" {
+        t.Errorf("RegisterStruct = %v, want a TagError of field A", err)
+    }
+}
+
+func TestCompareValues(t *testing.T) {
+    day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+    tests := []struct {
+        a, b interface{}
+        c    int
+        ok   bool
+    }{
+        {1, 2, -1, true},
+        {int8(3), uint64(3), 0, true},
+        {2.5, 2, 1, true},
+        {json.Number("10"), 9, 1, true},
+        {"a", "b", -1, true},
+        {day, day.Add(time.Second), -1, true},
+        {day, day, 0, true},
+        {day, "x", 0, false},
+        {1, "1", 0, false},
+        {"1", 1, 0, false},
+        {true, true, 0, false},
+    }
+
+    for _, test := range tests {
+        if c, ok := compareValues(test.a, test.b); c != test.c || ok != test.ok {
+            t.Errorf("compareValues(%v, %v) = %d, %v, want %d, %v", test.a, test.b, c, ok, test.c, test.ok)
+        }
+    }
+}
+
+func equalStrings(a []string, b []string) bool {
+    if len(a) != len(b) {
+        return false
+    }
+
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+
+    return true
+}
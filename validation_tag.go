@@ -0,0 +1,327 @@
+/*
+ * Copyright © 2016 Iury Braun
+ * Copyright © 2017 Weyboo
+ *
+ * Tag :: <RULE>;<RULE>;...
+ * Rule :: <NAME>,<ARG>=<VALUE>,... or <NAME>=<VALUE>, the value being the "value" argument
+ *
+ * e.g. `validate:"required;string,max=80;email"`, arguments in any order
+ */
+
+package sdtp
+
+import (
+    "fmt"
+    "math"
+    "sort"
+    "sync"
+    "reflect"
+    "strconv"
+    "strings"
+)
+
+// Validators of the tags parsed so far, by tag.
+var tagValidators sync.Map
+
+// Parses a validate tag into the validator of its rules, run in order.
+func parseTag(tag string) (Validator, error) {
+    var chain ChainValidator
+
+    for _, rule := range strings.Split(tag, ";") {
+        validator, err := parseRule(strings.TrimSpace(rule))
+        if err != nil {
+            return nil, err
+        }
+
+        chain = append(chain, validator)
+    }
+
+    if len(chain) == 1 {
+        return chain[0], nil
+    }
+
+    return chain, nil
+}
+
+// Parses a single rule, its name followed by its named arguments.
+func parseRule(rule string) (Validator, error) {
+    if rule == "" {
+        return nil, fmt.Errorf("empty rule")
+    }
+
+    parts := strings.Split(rule, ",")
+    name := strings.TrimSpace(parts[0])
+
+    args := make(map[string]string, len(parts))
+
+    if eq := strings.IndexByte(name, '='); eq >= 0 {
+        args["value"] = strings.TrimSpace(name[eq + 1:])
+        name = strings.TrimSpace(name[:eq])
+    }
+
+    for _, part := range parts[1:] {
+        eq := strings.IndexByte(part, '=')
+        if eq < 0 {
+            return nil, fmt.Errorf("rule %q: argument %q is not of the form name=value", name, part)
+        }
+
+        arg := strings.TrimSpace(part[:eq])
+        if _, exists := args[arg]; exists {
+            return nil, fmt.Errorf("rule %q: duplicate argument %q", name, arg)
+        }
+
+        args[arg] = strings.TrimSpace(part[eq + 1:])
+    }
+
+    validator, err := newValidator(name, args)
+    if err != nil {
+        return nil, fmt.Errorf("rule %q: %v", name, err)
+    }
+
+    return validator, nil
+}
+
+// ValidatorFactory builds the validator of a rule from its named arguments,
+// as {"min": "3"} for "string,min=3". It returns an error for unknown or
+// invalid arguments, reported when the tag is parsed.
+type ValidatorFactory func(args map[string]string) (Validator, error)
+
+// Registered validator factories, by rule name.
+var validators struct {
+    sync.RWMutex
+    factories map[string]ValidatorFactory
+}
+
+func init() {
+    RegisterValidator("required", func(args map[string]string) (Validator, error) {
+        return RequiredValidator{}, noArgs(args)
+    })
+    RegisterValidator("number", func(args map[string]string) (Validator, error) {
+        a := &ruleArgs{args: args}
+        validator := NumberValidator{Min: a.int("min", math.MinInt), Max: a.int("max", math.MaxInt)}
+        return validator, a.done()
+    })
+    RegisterValidator("string", func(args map[string]string) (Validator, error) {
+        a := &ruleArgs{args: args}
+        validator := StringValidator{Min: a.int("min", 0), Max: a.int("max", -1)}
+        return validator, a.done()
+    })
+    RegisterValidator("email", func(args map[string]string) (Validator, error) {
+        return EmailValidator{}, noArgs(args)
+    })
+    RegisterValidator("date", func(args map[string]string) (Validator, error) {
+        return DateValidator{}, noArgs(args)
+    })
+    RegisterValidator("username", func(args map[string]string) (Validator, error) {
+        a := &ruleArgs{args: args}
+        validator := UsernameValidator{Min: a.int("min", 0), Max: a.int("max", -1)}
+        return validator, a.done()
+    })
+}
+
+// RegisterValidator makes a rule available in validate tags. A rule
+// registered under an existing name replaces it, including the built-in
+// ones. It panics if the name is empty or holds one of ",;=" or a space.
+func RegisterValidator(name string, factory ValidatorFactory) {
+    if name == "" || strings.ContainsAny(name, ",;= ") {
+        panic("sdtp: invalid validator name " + strconv.Quote(name))
+    }
+    if factory == nil {
+        panic("sdtp: nil factory for validator " + name)
+    }
+
+    validators.Lock()
+    defer validators.Unlock()
+
+    if validators.factories == nil {
+        validators.factories = make(map[string]ValidatorFactory)
+    }
+
+    validators.factories[name] = factory
+
+    // Tags parsed so far may use the replaced rule
+    tagValidators.Range(func(tag, _ interface{}) bool {
+        tagValidators.Delete(tag)
+        return true
+    })
+}
+
+// Returns the validator of a rule, built by its registered factory.
+func newValidator(name string, args map[string]string) (Validator, error) {
+    validators.RLock()
+    factory := validators.factories[name]
+    validators.RUnlock()
+
+    if factory == nil {
+        return nil, fmt.Errorf("unknown validator")
+    }
+
+    validator, err := factory(args)
+    if err != nil {
+        return nil, err
+    }
+
+    if validator == nil {
+        return nil, fmt.Errorf("nil validator")
+    }
+
+    return validator, nil
+}
+
+// Returns an error when a rule taking no argument is given some.
+func noArgs(args map[string]string) error {
+    return (&ruleArgs{args: args}).done()
+}
+
+// Reads the named arguments of a rule, removing them as they are read.
+type ruleArgs struct {
+    args map[string]string
+    err  error
+}
+
+// Returns the integer argument name, or def when it is not given.
+func (a *ruleArgs) int(name string, def int) int {
+    value, ok := a.args[name]
+    if !ok {
+        return def
+    }
+
+    delete(a.args, name)
+
+    n, err := strconv.Atoi(value)
+    if err != nil {
+        if a.err == nil {
+            a.err = fmt.Errorf("argument %s=%s is not an integer", name, value)
+        }
+        return def
+    }
+
+    return n
+}
+
+// Returns the text argument name, or "" when it is not given.
+func (a *ruleArgs) string(name string) string {
+    value := a.args[name]
+    delete(a.args, name)
+
+    return value
+}
+
+// Returns the first invalid argument read, or an error naming the arguments
+// left unread.
+func (a *ruleArgs) done() error {
+    if a.err != nil || len(a.args) == 0 {
+        return a.err
+    }
+
+    unknown := make([]string, 0, len(a.args))
+    for name := range a.args {
+        unknown = append(unknown, name)
+    }
+    sort.Strings(unknown)
+
+    return fmt.Errorf("unknown arguments %s", strings.Join(unknown, ", "))
+}
+
+// TagError reports a malformed validate tag, or one naming an unknown
+// field. RegisterStruct returns it when the application starts, validating a
+// struct that was not registered reports it with an InternalError entry.
+type TagError struct {
+    Type  reflect.Type
+    Field string
+    Err   error
+}
+
+func (e *TagError) Error() string {
+    return fmt.Sprintf("sdtp: field %s.%s: %v", e.Type, e.Field, e.Err)
+}
+
+func (e *TagError) Unwrap() error {
+    return e.Err
+}
+
+// Returns the validator of a tag, parsed once, or the error of a malformed
+// tag. Use RegisterStruct to check the tags beforehand.
+func validatorOf(tag string) (Validator, error) {
+    if cached, ok := tagValidators.Load(tag); ok {
+        if err, ok := cached.(error); ok {
+            return nil, err
+        }
+        return cached.(Validator), nil
+    }
+
+    validator, err := parseTag(tag)
+    if err != nil {
+        tagValidators.Store(tag, err)
+        return nil, err
+    }
+
+    tagValidators.Store(tag, validator)
+
+    return validator, nil
+}
+
+// RegisterStruct parses the validate tags of the type of s and of the types
+// it holds, so that malformed tags are reported when the application starts
+// instead of when a request is validated.
+func RegisterStruct(s interface{}) error {
+    return registerType(reflect.TypeOf(s), make(map[reflect.Type]bool))
+}
+
+func registerType(t reflect.Type, visited map[reflect.Type]bool) error {
+    if t == nil || visited[t] {
+        return nil
+    }
+    visited[t] = true
+
+    switch t.Kind() {
+        case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+            return registerType(t.Elem(), visited)
+        case reflect.Struct:
+            for i := 0; i < t.NumField(); i++ {
+                field := t.Field(i)
+
+                tag := field.Tag.Get(tagName)
+                if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+                    continue
+                }
+
+                if tag != "" {
+                    validator, err := parseTag(tag)
+                    if err != nil {
+                        return &TagError{Type: t, Field: field.Name, Err: err}
+                    }
+
+                    if fr, ok := validator.(fieldReferrer); ok {
+                        for _, name := range fr.siblingFields() {
+                            if !hasField(t, name) {
+                                return &TagError{Type: t, Field: field.Name, Err: fmt.Errorf("unknown field %s", name)}
+                            }
+                        }
+                    }
+
+                    tagValidators.Store(tag, validator)
+                }
+
+                if err := registerType(field.Type, visited); err != nil {
+                    return err
+                }
+            }
+    }
+
+    return nil
+}
+
+// Returns true when the struct type t has a field name, matched as by
+// ValidationContext.Field.
+func hasField(t reflect.Type, name string) bool {
+    if _, ok := t.FieldByName(name); ok {
+        return true
+    }
+
+    _, ok := t.FieldByNameFunc(func(field_name string) bool {
+        return strings.EqualFold(field_name, name)
+    })
+
+    return ok
+}
@@ -0,0 +1,267 @@
+package sdtp
+
+import (
+    "math"
+    "errors"
+    "reflect"
+    "strconv"
+    "strings"
+    "testing"
+    "net/http/httptest"
+)
+
+func TestParseTag(t *testing.T) {
+    tests := []struct {
+        tag  string
+        want Validator
+    }{
+        {"required", RequiredValidator{}},
+        {"string,min=3,max=80", StringValidator{Min: 3, Max: 80}},
+        // Arguments in any order, with spaces
+        {"string, max = 80 , min=3", StringValidator{Min: 3, Max: 80}},
+        {"string,max=5", StringValidator{Min: 0, Max: 5}},
+        {"string,min=5", StringValidator{Min: 5, Max: -1}},
+        {"username,max=20", UsernameValidator{Min: 0, Max: 20}},
+        {"number,min=-1", NumberValidator{Min: -1, Max: math.MaxInt}},
+        {"required; string,min=2 ;email", ChainValidator{RequiredValidator{}, StringValidator{Min: 2, Max: -1}, EmailValidator{}}},
+        {"date;required", ChainValidator{DateValidator{}, RequiredValidator{}}},
+        // name=value shorthand
+        {"eqfield=Password", FieldValidator{Field: "Password", Op: "eq"}},
+        {"required_if=Kind:business", RequiredIfValidator{Field: "Kind", Value: "business"}},
+    }
+
+    for _, test := range tests {
+        validator, err := parseTag(test.tag)
+        if err != nil {
+            t.Errorf("%q: %v", test.tag, err)
+            continue
+        }
+
+        if !reflect.DeepEqual(validator, test.want) {
+            t.Errorf("%q: validator = %#v, want %#v", test.tag, validator, test.want)
+        }
+    }
+}
+
+func TestParseTagErrors(t *testing.T) {
+    tests := []struct {
+        tag string
+        err string
+    }{
+        {"", "empty rule"},
+        {"required;", "empty rule"},
+        {"required;;email", "empty rule"},
+        {"nosuch", `rule "nosuch": unknown validator`},
+        {"required;nosuch,min=1", `rule "nosuch": unknown validator`},
+        {"string,min=1,min=2", `rule "string": duplicate argument "min"`},
+        {"string,min", `rule "string": argument "min" is not of the form name=value`},
+        {"string,min=x", `rule "string": argument min=x is not an integer`},
+        {"string,min=1,foo=2,bar=3", `rule "string": unknown arguments bar, foo`},
+        {"required,x=1", `rule "required": unknown arguments x`},
+        {"email=x", `rule "email": unknown arguments value`},
+        {"eqfield", `rule "eqfield": missing field name`},
+        {"required_if=Kind", `rule "required_if": expected required_if=<FIELD>:<VALUE>`},
+    }
+
+    for _, test := range tests {
+        if _, err := parseTag(test.tag); err == nil || err.Error() != test.err {
+            t.Errorf("%q: err = %v, want %s", test.tag, err, test.err)
+        }
+    }
+}
+
+type badTagItem struct {
+    Sku string `validate:"string,mni=3"`
+}
+
+type badTagOrder struct {
+    Name  string `validate:"required"`
+    Items []*badTagItem
+}
+
+func TestRegisterStruct(t *testing.T) {
+    type good struct {
+        Name  string `validate:"required;string,max=80"`
+        Email string `validate:"email"`
+        Skip  string `validate:"-"`
+        Items []struct {
+            Sku string `validate:"required"`
+        }
+    }
+
+    if err := RegisterStruct(good{}); err != nil {
+        t.Errorf("RegisterStruct = %v", err)
+    }
+
+    if err := RegisterStruct(&good{}); err != nil {
+        t.Errorf("RegisterStruct of a pointer = %v", err)
+    }
+
+    // Malformed tags are found in the types held too
+    err := RegisterStruct(badTagOrder{})
+
+    var tag_err *TagError
+    if !errors.As(err, &tag_err) || tag_err.Type != reflect.TypeOf(badTagItem{}) || tag_err.Field != "Sku" {
+        t.Fatalf("err = %v, want a TagError of badTagItem.Sku", err)
+    }
+
+    if !strings.Contains(err.Error(), "unknown arguments mni") {
+        t.Errorf("err = %v, want it to name the unknown argument", err)
+    }
+}
+
+func TestMalformedTagAtRequestTime(t *testing.T) {
+    want := []string{"field:items[0].sku " + strconv.Itoa(InternalError)}
+
+    for i := 0; i < 2; i++ {
+        if entries := validateEntries(badTagOrder{Name: "x", Items: []*badTagItem{{}}}); !equalStrings(entries, want) {
+            t.Errorf("entries = %v, want %v", entries, want)
+        }
+    }
+}
+
+// Restores the factory of a rule once the test ends.
+func restoreValidator(t *testing.T, name string) {
+    validators.RLock()
+    factory := validators.factories[name]
+    validators.RUnlock()
+
+    t.Cleanup(func() {
+        if factory != nil {
+            RegisterValidator(name, factory)
+            return
+        }
+
+        validators.Lock()
+        delete(validators.factories, name)
+        validators.Unlock()
+
+        tagValidators.Range(func(tag, _ interface{}) bool {
+            tagValidators.Delete(tag)
+            return true
+        })
+    })
+}
+
+// Rejects values other than its prefix followed by anything.
+type prefixValidator struct {
+    prefix string
+}
+
+func (v prefixValidator) Validate(val interface{}, lang string) (bool, int, error) {
+    if str, _ := stringOf(val); !strings.HasPrefix(str, v.prefix) {
+        return false, Rejected, NewMessageError("validation-errors.Prefix", map[string]interface{}{"prefix": v.prefix})
+    }
+
+    return true, 0, nil
+}
+
+func TestRegisterValidator(t *testing.T) {
+    restoreValidator(t, "prefix")
+
+    RegisterValidator("prefix", func(args map[string]string) (Validator, error) {
+        a := &ruleArgs{args: args}
+        validator := prefixValidator{prefix: a.string("value")}
+        return validator, a.done()
+    })
+
+    type sku struct {
+        Code string `validate:"required;prefix=SKU-"`
+    }
+
+    if err := RegisterStruct(sku{}); err != nil {
+        t.Fatal(err)
+    }
+
+    if entries := validateEntries(sku{Code: "SKU-1"}); len(entries) != 0 {
+        t.Errorf("entries = %v, want none", entries)
+    }
+
+    err_map := ValidateStructFields(sku{Code: "X-1"}, httptest.NewRequest("POST", "/", nil))
+    if len(err_map) != 1 || err_map[0]["code"] != Rejected || err_map[0]["location"] != "field:code" {
+        t.Errorf("entries = %v, want code rejected", err_map)
+    }
+
+    if _, err := parseTag("prefix=a,b=1"); err == nil || err.Error() != `rule "prefix": unknown arguments b` {
+        t.Errorf("err = %v, want the factory error", err)
+    }
+}
+
+func TestRegisterValidatorReplacesBuiltIn(t *testing.T) {
+    restoreValidator(t, "email")
+
+    type contact struct {
+        Email string `validate:"email"`
+    }
+
+    // Parsed and cached with the built-in rule
+    if entries := validateEntries(contact{Email: "not an email"}); len(entries) != 1 {
+        t.Fatalf("entries = %v, want email rejected", entries)
+    }
+
+    RegisterValidator("email", func(args map[string]string) (Validator, error) {
+        return DefaultValidator{}, noArgs(args)
+    })
+
+    if entries := validateEntries(contact{Email: "not an email"}); len(entries) != 0 {
+        t.Errorf("entries = %v, want none once the rule is replaced", entries)
+    }
+}
+
+func TestRegisterValidatorClearsCachedErrors(t *testing.T) {
+    restoreValidator(t, "later")
+
+    if _, err := validatorOf("later"); err == nil {
+        t.Fatal("unknown rule parsed")
+    }
+
+    RegisterValidator("later", func(args map[string]string) (Validator, error) {
+        return DefaultValidator{}, noArgs(args)
+    })
+
+    if validator, err := validatorOf("later"); err != nil || validator != (DefaultValidator{}) {
+        t.Errorf("validatorOf = %v, %v, want the registered rule", validator, err)
+    }
+}
+
+func TestRegisterValidatorPanics(t *testing.T) {
+    factory := func(args map[string]string) (Validator, error) {
+        return DefaultValidator{}, nil
+    }
+
+    tests := []struct {
+        name    string
+        factory ValidatorFactory
+    }{
+        {"", factory},
+        {"a,b", factory},
+        {"a;b", factory},
+        {"a=b", factory},
+        {"a b", factory},
+        {"nilfactory", nil},
+    }
+
+    for _, test := range tests {
+        func() {
+            defer func() {
+                if recover() == nil {
+                    t.Errorf("RegisterValidator(%q) does not panic", test.name)
+                }
+            }()
+
+            RegisterValidator(test.name, test.factory)
+        }()
+    }
+}
+
+func TestNilValidatorFromFactory(t *testing.T) {
+    restoreValidator(t, "nilrule")
+
+    RegisterValidator("nilrule", func(args map[string]string) (Validator, error) {
+        return nil, nil
+    })
+
+    if _, err := parseTag("nilrule"); err == nil || err.Error() != `rule "nilrule": nil validator` {
+        t.Errorf("err = %v, want a nil validator error", err)
+    }
+}
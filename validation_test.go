@@ -0,0 +1,423 @@
+package sdtp
+
+import (
+    "time"
+    "errors"
+    "reflect"
+    "testing"
+    "net/http"
+    "encoding/json"
+    "database/sql"
+    "net/http/httptest"
+)
+
+type walkAddress struct {
+    City string `validate:"required"`
+}
+
+type walkItem struct {
+    Sku string `validate:"required"`
+}
+
+type walkAudit struct {
+    By string `validate:"required"`
+}
+
+type walkOrder struct {
+    walkAudit
+
+    Address  walkAddress
+    Shipping *walkAddress
+    Items    []walkItem
+    Lines    [2]*walkItem
+    ByCode   map[string]walkItem
+    Extra    interface{}
+    Groups   [][]walkItem
+    Data     []byte
+    Counts   map[string]int
+    Skipped  walkItem `validate:"-"`
+    hidden   walkItem
+}
+
+func TestWalkLocations(t *testing.T) {
+    order := walkOrder{
+        walkAudit: walkAudit{},
+        Shipping: &walkAddress{},
+        Items: []walkItem{{Sku: "a"}, {Sku: "b"}, {}},
+        Lines: [2]*walkItem{nil, {}},
+        ByCode: map[string]walkItem{"b": {}, "a": {}, "c": {Sku: "c"}},
+        Extra: &walkItem{},
+        Groups: [][]walkItem{{{Sku: "x"}}, {{Sku: "y"}, {}}},
+        Data: []byte("data"),
+        Counts: map[string]int{"a": 1},
+    }
+
+    want := []string{
+        "field:by 1",
+        "field:address.city 1",
+        "field:shipping.city 1",
+        "field:items[2].sku 1",
+        "field:lines[1].sku 1",
+        "field:bycode[a].sku 1",
+        "field:bycode[b].sku 1",
+        "field:extra.sku 1",
+        "field:groups[1][1].sku 1",
+    }
+
+    if entries := validateEntries(order); !equalStrings(entries, want) {
+        t.Errorf("entries = %v, want %v", entries, want)
+    }
+
+    // Through a pointer too
+    if entries := validateEntries(&order); !equalStrings(entries, want) {
+        t.Errorf("entries of a pointer = %v, want %v", entries, want)
+    }
+}
+
+type walkNode struct {
+    Name     string `validate:"required"`
+    Next     *walkNode
+    Children []*walkNode
+}
+
+func TestWalkCycles(t *testing.T) {
+    a := &walkNode{Name: "a"}
+    b := &walkNode{}
+
+    a.Next, b.Next = b, a
+    a.Children = []*walkNode{a, b}
+
+    // b is reported once, where it is first reached
+    want := []string{"field:next.name 1"}
+
+    if entries := validateEntries(a); !equalStrings(entries, want) {
+        t.Errorf("entries = %v, want %v", entries, want)
+    }
+}
+
+func TestWalkNil(t *testing.T) {
+    var order *walkOrder
+
+    for _, s := range []interface{}{nil, order, walkOrder{walkAudit: walkAudit{By: "x"}, Address: walkAddress{City: "y"}}} {
+        if entries := validateEntries(s); len(entries) != 0 {
+            t.Errorf("%#v: entries = %v, want none", s, entries)
+        }
+    }
+}
+
+type recursiveSlice []recursiveSlice
+
+func TestMayHoldStruct(t *testing.T) {
+    tests := []struct {
+        v    interface{}
+        want bool
+    }{
+        {[]byte{}, false},
+        {[]string{}, false},
+        {[4]int{}, false},
+        {map[string]int{}, false},
+        {map[string][]float64{}, false},
+        {[][]byte{}, false},
+        {recursiveSlice{}, false},
+        {[]time.Time{}, true},
+        {[]walkItem{}, true},
+        {[]*int{}, true},
+        {[]interface{}{}, true},
+        {map[string]walkItem{}, true},
+        {[][2]map[int]*walkItem{}, true},
+    }
+
+    for _, test := range tests {
+        if got := mayHoldStruct(reflect.TypeOf(test.v)); got != test.want {
+            t.Errorf("mayHoldStruct(%T) = %v, want %v", test.v, got, test.want)
+        }
+    }
+}
+
+func TestWalkSkipsLargeByteSlices(t *testing.T) {
+    type upload struct {
+        Name string `validate:"required"`
+        Data []byte
+    }
+
+    start_time := time.Now()
+
+    if entries := validateEntries(upload{Data: make([]byte, 10 << 20)}); !equalStrings(entries, []string{"field:name 1"}) {
+        t.Errorf("entries = %v, want name required", entries)
+    }
+
+    if elapsed := time.Since(start_time); elapsed > 100 * time.Millisecond {
+        t.Errorf("validating 10 MB of bytes took %v", elapsed)
+    }
+}
+
+func TestIndirectValue(t *testing.T) {
+    s := "x"
+    ps := &s
+    var nil_s *string
+    day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+    tests := []struct {
+        val  interface{}
+        want interface{}
+    }{
+        {nil, nil},
+        {"x", "x"},
+        {&s, "x"},
+        {&ps, "x"},
+        {nil_s, nil},
+        {sql.NullString{String: "y", Valid: true}, "y"},
+        {sql.NullString{String: "y"}, nil},
+        {&sql.NullInt64{Int64: 3, Valid: true}, int64(3)},
+        {sql.NullTime{Time: day, Valid: true}, day},
+        {sql.NullTime{}, nil},
+    }
+
+    for _, test := range tests {
+        if got := indirectValue(test.val); got != test.want {
+            t.Errorf("indirectValue(%#v) = %#v, want %#v", test.val, got, test.want)
+        }
+    }
+}
+
+type namedString string
+
+func TestValueOf(t *testing.T) {
+    s := "x"
+    n := 3
+    var nil_n *int
+    day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+    strs := []struct {
+        val  interface{}
+        want string
+        ok   bool
+    }{
+        {"x", "x", true},
+        {&s, "x", true},
+        {namedString("y"), "y", true},
+        {nil, "", true},
+        {sql.NullString{}, "", true},
+        {3, "", false},
+        {[]byte("x"), "", false},
+    }
+
+    for _, test := range strs {
+        if got, ok := stringOf(test.val); got != test.want || ok != test.ok {
+            t.Errorf("stringOf(%#v) = %q, %v, want %q, %v", test.val, got, ok, test.want, test.ok)
+        }
+    }
+
+    ints := []struct {
+        val  interface{}
+        want int
+        ok   bool
+    }{
+        {3, 3, true},
+        {&n, 3, true},
+        {nil_n, 0, true},
+        {uint8(7), 7, true},
+        {2.0, 2, true},
+        {2.5, 2, false},
+        {json.Number("12"), 12, true},
+        {sql.NullInt64{Int64: 4, Valid: true}, 4, true},
+        {"3", 0, false},
+    }
+
+    for _, test := range ints {
+        if got, ok := intOf(test.val); got != test.want || ok != test.ok {
+            t.Errorf("intOf(%#v) = %d, %v, want %d, %v", test.val, got, ok, test.want, test.ok)
+        }
+    }
+
+    times := []struct {
+        val  interface{}
+        want time.Time
+        ok   bool
+    }{
+        {day, day, true},
+        {&day, day, true},
+        {nil, time.Time{}, true},
+        {sql.NullTime{Time: day, Valid: true}, day, true},
+        {sql.NullTime{}, time.Time{}, true},
+        {"2024-01-02", time.Time{}, false},
+    }
+
+    for _, test := range times {
+        if got, ok := timeOf(test.val); !got.Equal(test.want) || ok != test.ok {
+            t.Errorf("timeOf(%#v) = %v, %v, want %v, %v", test.val, got, ok, test.want, test.ok)
+        }
+    }
+}
+
+func TestValidatorsOnMismatchedTypes(t *testing.T) {
+    tests := []struct {
+        validator Validator
+        val       interface{}
+        kind      string
+    }{
+        {StringValidator{}, 3, "string"},
+        {EmailValidator{}, 3, "string"},
+        {UsernameValidator{}, true, "string"},
+        {NumberValidator{}, "3", "number"},
+        {DateValidator{}, "2024-01-02", "date"},
+    }
+
+    for _, test := range tests {
+        valid, code_error, err := test.validator.Validate(test.val, "en")
+
+        var e *MessageError
+        if valid || code_error != Rejected || !errors.As(err, &e) || e.Key != "validation-errors.Type" || e.Args["type"] != test.kind {
+            t.Errorf("%T(%#v) = %v, %d, %v, want a %s type error", test.validator, test.val, valid, code_error, err, test.kind)
+        }
+    }
+}
+
+type nullableFields struct {
+    Name     *string        `validate:"required"`
+    Nick     sql.NullString `validate:"string,max=3"`
+    Age      *int           `validate:"number,min=18"`
+    Born     sql.NullTime   `validate:"date"`
+    Birthday *time.Time     `validate:"required;date"`
+}
+
+func TestValidatePointersAndNullTypes(t *testing.T) {
+    name := "x"
+    age := 12
+    day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+    tests := []struct {
+        s    interface{}
+        want []string
+    }{
+        {nullableFields{}, []string{
+            "field:name 1",
+            "field:nick 1",
+            // No number is 0
+            "field:age 2",
+            "field:born 4",
+            "field:birthday 1",
+        }},
+        {&nullableFields{
+            Name: &name,
+            Nick: sql.NullString{String: "long", Valid: true},
+            Age: &age,
+            Born: sql.NullTime{Time: day, Valid: true},
+            Birthday: &day,
+        }, []string{
+            "field:nick 3",
+            "field:age 2",
+        }},
+    }
+
+    for _, test := range tests {
+        if entries := validateEntries(test.s); !equalStrings(entries, test.want) {
+            t.Errorf("%+v: entries = %v, want %v", test.s, entries, test.want)
+        }
+    }
+}
+
+// Translates with messages, answering "" for the keys it lacks as INI files
+// do.
+type mapTranslator map[string]string
+
+func (tr mapTranslator) Lang(r *http.Request) string {
+    return "xx"
+}
+
+func (tr mapTranslator) T(lang string, key string, args map[string]interface{}) string {
+    return Interpolate(tr[key], args)
+}
+
+type argsFields struct {
+    Name  string `validate:"string,min=3,max=5"`
+    Title string `validate:"string,max=2"`
+    Age   int    `validate:"number,min=18"`
+}
+
+func TestFieldEntryArgs(t *testing.T) {
+    err_map := ValidateStructFields(argsFields{Name: "ab", Title: "abc", Age: 12}, httptest.NewRequest("POST", "/", nil))
+
+    want := E1{
+        {
+            "code": TooLow,
+            "location": "field:name",
+            "message": "must be at least 3 characters",
+            "args": map[string]interface{}{"min": 3, "length": 2, "field": "name"},
+        },
+        {
+            "code": LimitExceeded,
+            "location": "field:title",
+            "message": "must be at most 2 characters",
+            "args": map[string]interface{}{"max": 2, "length": 3, "field": "title"},
+        },
+        {
+            "code": TooLow,
+            "location": "field:age",
+            "message": "must be at least 18",
+            "args": map[string]interface{}{"min": 18, "value": 12, "field": "age"},
+        },
+    }
+
+    if !reflect.DeepEqual(err_map, want) {
+        t.Errorf("entries = %v, want %v", err_map, want)
+    }
+}
+
+func TestFieldEntryFallsBackToParameterErrors(t *testing.T) {
+    tr := mapTranslator{
+        "parameter-errors.TooLow": "{field}: minimo {min}",
+        "parameter-errors.LimitExceeded": "excedido",
+        "validation-errors.NumberTooLow": "idade minima {min}",
+    }
+
+    r := WithConfig(httptest.NewRequest("POST", "/", nil), &Config{Translator: tr})
+
+    err_map := ValidateStructFields(argsFields{Name: "ab", Title: "abc", Age: 12}, r)
+
+    var messages []string
+    for _, entry := range err_map {
+        messages = append(messages, entry["message"].(string))
+    }
+
+    want := []string{"name: minimo 3", "excedido", "idade minima 18"}
+    if !equalStrings(messages, want) {
+        t.Errorf("messages = %v, want %v", messages, want)
+    }
+
+    // Translators answering the key itself fall back too
+    r = WithConfig(httptest.NewRequest("POST", "/", nil), &Config{Translator: keyTranslator{}})
+
+    if err_map := ValidateStructFields(argsFields{Name: "abc", Title: "ab", Age: 12}, r); err_map[0]["message"] != "parameter-errors.TooLow" {
+        t.Errorf("entries = %v, want the parameter-errors key", err_map)
+    }
+}
+
+// Answers every key as is.
+type keyTranslator struct{}
+
+func (keyTranslator) Lang(r *http.Request) string {
+    return "xx"
+}
+
+func (keyTranslator) T(lang string, key string, args map[string]interface{}) string {
+    return key
+}
+
+func TestStringLengthCountsCharacters(t *testing.T) {
+    tests := []struct {
+        val  string
+        want bool
+    }{
+        {"éèà", true},
+        {"日本語です", true},
+        {"日本語ですよ", false},
+        {"ab", false},
+    }
+
+    for _, test := range tests {
+        if valid, _, _ := (StringValidator{Min: 3, Max: 5}).Validate(test.val, "en"); valid != test.want {
+            t.Errorf("%q: valid = %v, want %v", test.val, valid, test.want)
+        }
+    }
+}